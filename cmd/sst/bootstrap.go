@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/fatih/color"
+	"github.com/sst/ion/cmd/sst/ui"
+	"github.com/sst/ion/internal/util"
+	"github.com/sst/ion/pkg/project"
+	"github.com/sst/ion/pkg/project/provider"
+)
+
+func CmdBootstrap(cli *Cli) error {
+	cfgPath, err := project.Discover()
+	if err != nil {
+		return util.NewReadableError(err, "Could not find sst.config.ts")
+	}
+	stage, err := getStage(cli, cfgPath)
+	if err != nil {
+		return util.NewReadableError(err, "Could not find stage")
+	}
+	p, err := newProjectStage(cli, cfgPath, stage)
+	if err != nil {
+		return err
+	}
+	defer p.Cleanup()
+	if err := p.LoadProvidersForBootstrap(); err != nil {
+		return util.NewReadableError(err, err.Error())
+	}
+
+	name := p.App().Home
+	home, ok := p.Backend().(provider.Bootstrapper)
+	if !ok {
+		return util.NewReadableError(nil, fmt.Sprintf("The %s home does not need to be bootstrapped", name))
+	}
+	plan, err := home.PlanBootstrap()
+	if err != nil {
+		return util.NewReadableError(err, err.Error())
+	}
+	if len(plan) == 0 {
+		ui.Success(fmt.Sprintf("The %s bootstrap is up to date", name))
+		return nil
+	}
+
+	color.New(color.FgYellow, color.Bold).Print("!")
+	color.New(color.FgWhite, color.Bold).Printf("  This will bootstrap the %s home\n", name)
+	for _, item := range plan {
+		color.New(color.FgYellow, color.Bold).Print("|  ")
+		color.New(color.FgHiBlack).Println(item)
+	}
+	fmt.Println()
+	if !cli.Bool("yes") {
+		if !ui.IsInteractive() {
+			return util.NewReadableError(nil, "Pass in --yes to bootstrap in a non-interactive session.")
+		}
+		if !ui.Ask("Continue") {
+			return nil
+		}
+	}
+
+	err = home.Bootstrap()
+	if err != nil {
+		return util.NewReadableError(err, "Could not bootstrap: "+err.Error())
+	}
+	ui.Success(fmt.Sprintf("Bootstrapped the %s home", name))
+	return nil
+}
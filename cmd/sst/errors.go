@@ -11,6 +11,7 @@ func TransformError(err error) error {
 		project.ErrInvalidStageName: "The stage name is invalid. It can only contain alphanumeric characters and hyphens.",
 		project.ErrV2Config:         "You are using sst ion and this looks like an sst v2 config",
 		project.ErrStageNotFound:    "Stage not found",
+		project.ErrStackCancelled:   "Cancelled",
 		provider.ErrLockExists:      "",
 	}
 
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/common/apitype"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource"
+	"github.com/sst/ion/internal/util"
+	"github.com/sst/ion/pkg/project"
+)
+
+type graphNode struct {
+	URN    string `json:"urn"`
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Parent string `json:"parent,omitempty"`
+}
+
+type graphEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Kind string `json:"kind"`
+}
+
+type graph struct {
+	Nodes []graphNode `json:"nodes"`
+	Edges []graphEdge `json:"edges"`
+}
+
+func CmdGraph(cli *Cli) error {
+	p, err := initProject(cli)
+	if err != nil {
+		return err
+	}
+	defer p.Cleanup()
+
+	deployment, err := p.Stack.Deployment(cli.Context)
+	if err != nil {
+		if err == project.ErrStageNotFound {
+			return err
+		}
+		return util.NewReadableError(err, "Could not read state")
+	}
+
+	types := []string{}
+	if filter := cli.String("type"); filter != "" {
+		types = strings.Split(filter, ",")
+	}
+	g := buildGraph(deployment.Resources, types, cli.Bool("collapse"))
+
+	var data string
+	switch format := cli.String("format"); format {
+	case "", "dot":
+		data = g.dot(p.App().Name + "/" + p.App().Stage)
+	case "mermaid":
+		data = g.mermaid()
+	case "json":
+		bytes, err := json.MarshalIndent(g, "", "  ")
+		if err != nil {
+			return err
+		}
+		data = string(bytes) + "\n"
+	default:
+		return util.NewReadableError(nil, fmt.Sprintf("Unknown format \"%s\", use dot, mermaid, or json", format))
+	}
+
+	out := cli.String("out")
+	if out == "" {
+		fmt.Print(data)
+		return nil
+	}
+	err = os.MkdirAll(filepath.Dir(out), 0755)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(out, []byte(data), 0644)
+}
+
+// buildGraph turns the resources in state into a graph of parent and
+// dependency edges. When collapse is set, every resource is folded into its
+// top level component.
+func buildGraph(resources []apitype.ResourceV3, types []string, collapse bool) *graph {
+	parents := map[string]string{}
+	for _, item := range resources {
+		parents[string(item.URN)] = string(item.Parent)
+	}
+
+	// root resolves a resource to the node it is drawn as
+	root := func(urn string) string {
+		if !collapse {
+			return urn
+		}
+		for {
+			parent := parents[urn]
+			if parent == "" || resource.URN(parent).Type() == "pulumi:pulumi:Stack" {
+				return urn
+			}
+			urn = parent
+		}
+	}
+
+	included := map[string]bool{}
+	result := &graph{
+		Nodes: []graphNode{},
+		Edges: []graphEdge{},
+	}
+	for _, item := range resources {
+		urn := string(item.URN)
+		if item.Type == "pulumi:pulumi:Stack" || strings.HasPrefix(string(item.Type), "pulumi:providers:") {
+			continue
+		}
+		if root(urn) != urn {
+			continue
+		}
+		if !matchesType(string(item.Type), types) {
+			continue
+		}
+		included[urn] = true
+		node := graphNode{
+			URN:  urn,
+			Name: item.URN.Name(),
+			Type: string(item.Type),
+		}
+		if !collapse && item.Parent != "" && item.Parent.Type() != "pulumi:pulumi:Stack" {
+			node.Parent = string(item.Parent)
+		}
+		result.Nodes = append(result.Nodes, node)
+	}
+
+	seen := map[graphEdge]bool{}
+	add := func(edge graphEdge) {
+		if edge.From == edge.To || !included[edge.From] || !included[edge.To] || seen[edge] {
+			return
+		}
+		seen[edge] = true
+		result.Edges = append(result.Edges, edge)
+	}
+	for _, item := range resources {
+		urn := root(string(item.URN))
+		if !collapse && item.Parent != "" {
+			add(graphEdge{From: string(item.Parent), To: urn, Kind: "parent"})
+		}
+		for _, dep := range item.Dependencies {
+			add(graphEdge{From: root(string(dep)), To: urn, Kind: "dependency"})
+		}
+	}
+	sort.Slice(result.Edges, func(i, j int) bool {
+		if result.Edges[i].From == result.Edges[j].From {
+			return result.Edges[i].To < result.Edges[j].To
+		}
+		return result.Edges[i].From < result.Edges[j].From
+	})
+	return result
+}
+
+func matchesType(input string, types []string) bool {
+	if len(types) == 0 {
+		return true
+	}
+	for _, item := range types {
+		if strings.HasPrefix(input, strings.TrimSpace(item)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *graph) dot(name string) string {
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf("digraph %q {\n", name))
+	builder.WriteString("  rankdir=LR;\n")
+	builder.WriteString("  node [shape=box];\n")
+	for _, node := range g.Nodes {
+		builder.WriteString(fmt.Sprintf("  %q [label=%q];\n", node.URN, node.Name+"\n"+node.Type))
+	}
+	for _, edge := range g.Edges {
+		style := ""
+		if edge.Kind == "parent" {
+			style = " [style=dashed]"
+		}
+		builder.WriteString(fmt.Sprintf("  %q -> %q%s;\n", edge.From, edge.To, style))
+	}
+	builder.WriteString("}\n")
+	return builder.String()
+}
+
+func (g *graph) mermaid() string {
+	ids := map[string]string{}
+	var builder strings.Builder
+	builder.WriteString("graph LR\n")
+	for i, node := range g.Nodes {
+		ids[node.URN] = fmt.Sprintf("n%d", i)
+		label := strings.ReplaceAll(node.Name, "\"", "#quot;") + "<br/>" + node.Type
+		builder.WriteString(fmt.Sprintf("  %s[\"%s\"]\n", ids[node.URN], label))
+	}
+	for _, edge := range g.Edges {
+		arrow := "-->"
+		if edge.Kind == "parent" {
+			arrow = "-.->"
+		}
+		builder.WriteString(fmt.Sprintf("  %s %s %s\n", ids[edge.From], arrow, ids[edge.To]))
+	}
+	return builder.String()
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/sst/ion/cmd/sst/ui"
+	"github.com/sst/ion/internal/util"
+	"github.com/sst/ion/pkg/project"
+)
+
+func CmdHistory(cli *Cli) error {
+	p, err := initProject(cli)
+	if err != nil {
+		return err
+	}
+	defer p.Cleanup()
+
+	history, err := p.Stack.History()
+	if err != nil {
+		return util.NewReadableError(err, "Could not get history")
+	}
+
+	if arg := cli.Positional(0); arg != "" {
+		index, err := strconv.Atoi(arg)
+		if err != nil || index < 1 || index > len(history) {
+			return util.NewReadableError(err, fmt.Sprintf("No history entry %s for stage \"%s\"", arg, p.App().Stage))
+		}
+		data, err := json.MarshalIndent(history[index-1], "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	if len(history) == 0 {
+		ui.Success(fmt.Sprintf("No history for stage \"%s\"", p.App().Stage))
+		return nil
+	}
+	for index, entry := range history {
+		printHistoryEntry(index+1, entry)
+	}
+	return nil
+}
+
+func printHistoryEntry(index int, entry project.HistoryEntry) {
+	icon := color.New(color.FgGreen, color.Bold).Sprint(ui.IconCheck)
+	if len(entry.Errors) > 0 || !entry.Finished {
+		icon = color.New(color.FgRed, color.Bold).Sprint(ui.IconX)
+	}
+	fmt.Print(icon + "  ")
+	color.New(color.FgWhite, color.Bold).Printf("%-4d", index)
+	color.New(color.FgWhite).Printf("%-8s", entry.Command)
+	color.New(color.FgHiBlack).Print(entry.Started.Local().Format(time.DateTime) + "  ")
+	color.New(color.FgHiBlack).Printf("%-8s", time.Duration(entry.Duration*float64(time.Second)).Round(time.Second).String())
+	color.New(color.FgHiBlack).Print(entry.User + "  ")
+	color.New(color.FgHiBlack).Print("v" + entry.Version)
+	if entry.Git != nil {
+		color.New(color.FgHiBlack).Print("  " + entry.Git.Commit[:min(len(entry.Git.Commit), 7)])
+		if entry.Git.Dirty {
+			color.New(color.FgHiBlack).Print("*")
+		}
+	}
+	changes := []string{}
+	for op, count := range entry.Changes {
+		changes = append(changes, fmt.Sprintf("%d %s", count, op))
+	}
+	sort.Strings(changes)
+	if len(changes) > 0 {
+		color.New(color.FgWhite).Print("  " + strings.Join(changes, ", "))
+	}
+	fmt.Println()
+}
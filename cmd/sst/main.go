@@ -13,6 +13,7 @@ import (
 	"os/user"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -72,15 +73,10 @@ func run() error {
 	godotenv.Load()
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
-	interruptChannel := make(chan os.Signal, 1)
-	signal.Notify(interruptChannel, syscall.SIGINT)
-	go func() {
-		<-interruptChannel
-		cancel()
-	}()
-
 	parsedFlags := map[string]interface{}{}
-	Root.registerFlags(parsedFlags)
+	if err := Root.registerFlags(parsedFlags, map[string]Flag{}); err != nil {
+		return err
+	}
 	flag.CommandLine.Init("sst", flag.ContinueOnError)
 	cliParseError := flag.CommandLine.Parse(os.Args[1:])
 
@@ -108,13 +104,30 @@ func run() error {
 		cmds = append(cmds, *cmd)
 	}
 	cli := &Cli{
-		flags:     parsedFlags,
-		arguments: positionals,
-		path:      cmds,
-		Context:   ctx,
-		cancel:    cancel,
+		flags:       parsedFlags,
+		arguments:   positionals,
+		path:        cmds,
+		Context:     ctx,
+		cancel:      cancel,
+		interrupted: make(chan struct{}),
 	}
 	configureLog(cli)
+	configureColor(cli)
+
+	interruptChannel := make(chan os.Signal, 1)
+	signal.Notify(interruptChannel, syscall.SIGINT)
+	go func() {
+		<-interruptChannel
+		if cli.graceful.Load() {
+			// pulumi is in the same process group so it gets the interrupt
+			// too and cancels the operations in progress
+			fmt.Println()
+			ui.Warn("Cancelling, waiting for the operations in progress to finish. Press Ctrl-C again to force exit.")
+			close(cli.interrupted)
+			<-interruptChannel
+		}
+		cancel()
+	}()
 	if cliParseError != nil {
 		return cli.PrintHelp()
 	}
@@ -154,6 +167,43 @@ func run() error {
 	}
 }
 
+// Flags are registered globally, so the ones shared by more than one command
+// are defined once.
+var (
+	yesFlag = Flag{
+		Name: "yes",
+		Type: "bool",
+		Description: Description{
+			Short: "Skip the confirmation",
+			Long: strings.Join([]string{
+				"Skip asking to confirm. On `sst deploy`, this confirms replacing or deleting resources with a `protected` type. On `sst bootstrap`, this creates the bootstrap.",
+				"",
+				"In a non-interactive session, like in CI, these commands fail instead of asking. Pass this in to run them anyway.",
+				"",
+				"```bash frame=\"none\"",
+				"sst deploy --stage=production --yes",
+				"```",
+			}, "\n"),
+		},
+	}
+	formatFlag = Flag{
+		Name: "format",
+		Type: "string",
+		Description: Description{
+			Short: "The format to print in",
+			Long:  "The format to print in. For `sst outputs`, one of `json`, `dotenv`, or `yaml`. For `sst graph`, one of `dot`, `mermaid`, or `json`, and defaults to `dot`.",
+		},
+	}
+	outFlag = Flag{
+		Name: "out",
+		Type: "string",
+		Description: Description{
+			Short: "Write to a file",
+			Long:  "Write to a file instead of printing.",
+		},
+	}
+)
+
 var Root = Command{
 	Name: "sst",
 	Description: Description{
@@ -207,6 +257,26 @@ var Root = Command{
 				}, "\n"),
 			},
 		},
+		{
+			Name: "stage-strategy",
+			Type: "string",
+			Description: Description{
+				Short: "Derive the stage when it is not passed in",
+				Long: strings.Join([]string{
+					"Derive the stage from your environment instead of the `.sst/stage` file. This can also be set with the `SST_STAGE_STRATEGY` environment variable.",
+					"",
+					"- `branch`: the current git branch",
+					"- `user`: the username on the local machine",
+					"- A template, like `{user}-{branch}`",
+					"",
+					"```bash frame=\"none\"",
+					"sst deploy --stage-strategy=branch",
+					"```",
+					"",
+					"The result is lowercased and any invalid characters are replaced with `-`. Names longer than 32 characters are truncated and suffixed with a short hash, so every branch gets its own stage.",
+				}, "\n"),
+			},
+		},
 		{
 			Name: "verbose",
 			Type: "bool",
@@ -223,6 +293,24 @@ var Root = Command{
 				}, "\n"),
 			},
 		},
+		{
+			Name: "color",
+			Type: "bool",
+			Description: Description{
+				Short: "Force colored output",
+				Long: strings.Join([]string{
+					"",
+					"When the output is not a terminal, or the `CI` environment variable is set, the CLI prints plain progress lines without colors or a spinner.",
+					"",
+					"Pass this in to keep the colors in that case.",
+					"",
+					"```bash",
+					"sst deploy --color",
+					"```",
+					"",
+				}, "\n"),
+			},
+		},
 		{
 			Name: "help",
 			Type: "bool",
@@ -285,7 +373,8 @@ var Root = Command{
 					"1. Starts a local server",
 					"2. Watches your app config and re-deploys your changes",
 					"3. Run your functions [Live](/docs/live/)",
-					"4. If you pass in a `command`, it'll:",
+					"4. Runs your Cloudflare Workers locally, starting at `http://localhost:8787`",
+					"5. If you pass in a `command`, it'll:",
 					"   - Load your [linked resources](/docs/linking) in the environment",
 					"   - And run the command",
 					"",
@@ -293,6 +382,8 @@ var Root = Command{
 					"If you run `sst dev` with a command, it will not print your function logs.",
 					":::",
 					"",
+					"Policies in `sst.policy.*` files are not checked in dev mode, only by `sst deploy`.",
+					"",
 					"If `sst dev` starts your frontend, it won't print logs from your SST app. We do this to prevent your logs from being too noisy. To view your logs, you can run `sst dev` in a separate terminal.",
 					"",
 					":::tip",
@@ -346,8 +437,100 @@ var Root = Command{
 					"```bash frame=\"none\"",
 					"sst deploy --stage=production",
 					"```",
+					"",
+					"Or deploy to several stages at the same time, by passing in a comma separated list. The output of each stage is prefixed with its name.",
+					"",
+					"```bash frame=\"none\"",
+					"sst deploy --stage=us-east-1,eu-west-1,ap-south-1",
+					"```",
+					"",
+					"When deploying several stages, the `.env.<stage>` files are not loaded and protected resources are only replaced or deleted if you pass in `--yes`.",
+					"",
+					"Before anything is created, the planned resources are checked against the policies next to your `sst.config.ts`. The deploy fails if any of them are violated, or if the changes cannot be previewed to check them.",
+					"",
+					"- `sst.policy.json` or `sst.policy.yaml`: a list of `rules`, each with a `type`, a `property` path into the resource inputs, and one of `required`, `in`, or `notIn`.",
+					"- `sst.policy.ts`: a function, or a list of functions, that take a resource with its `urn`, `type`, and `inputs`, and return a message or a list of messages for each violation.",
+					"",
+					"Policies are not checked by `sst dev`, since it redeploys on every change to your app. They are checked by `sst deploy`.",
+					"",
+					"```yaml title=\"sst.policy.yaml\"",
+					"rules:",
+					"  - name: no-public-buckets",
+					"    type: aws:s3/bucketV2:BucketV2",
+					"    property: acl",
+					"    notIn: [public-read, public-read-write]",
+					"  - name: allowed-regions",
+					"    type: pulumi:providers:aws",
+					"    property: region",
+					"    in: [us-east-1, eu-west-1]",
+					"```",
 				}, "\n"),
 			},
+			Flags: []Flag{
+				{
+					Name: "all",
+					Type: "bool",
+					Description: Description{
+						Short: "Deploy every app in the repo",
+						Long: strings.Join([]string{
+							"Deploy every app with an `sst.config.ts` in the repo to the same stage.",
+							"",
+							"```bash frame=\"none\"",
+							"sst deploy --all --stage=production",
+							"```",
+							"",
+							"Apps that reference the outputs of another app in the same stage with `$ref` are deployed after it. The other apps are deployed in parallel, up to `--concurrency` at a time. If an app fails to deploy, the apps that depend on it are skipped.",
+						}, "\n"),
+					},
+				},
+				{
+					Name: "concurrency",
+					Type: "string",
+					Description: Description{
+						Short: "The max number of stages or apps to deploy at the same time",
+						Long: strings.Join([]string{
+							"When deploying to several stages or apps, the max number of them that are deployed at the same time. Defaults to 4.",
+							"",
+							"```bash frame=\"none\"",
+							"sst deploy --stage=us-east-1,eu-west-1,ap-south-1 --concurrency=2",
+							"```",
+						}, "\n"),
+					},
+				},
+				{
+					Name: "report",
+					Type: "string",
+					Description: Description{
+						Short: "Write a deploy report to a file",
+						Long: strings.Join([]string{
+							"Write a summary of the deploy with the time each resource took to the given path.",
+							"",
+							"```bash frame=\"none\"",
+							"sst deploy --report=report.json",
+							"```",
+							"",
+							"If the path ends in `.xml`, the report is written in the JUnit format so it can be picked up by your CI.",
+						}, "\n"),
+					},
+				},
+				yesFlag,
+				{
+					Name: "outputs-file",
+					Type: "string",
+					Description: Description{
+						Short: "Write the outputs to a file",
+						Long: strings.Join([]string{
+							"Write the outputs of your app to a file once the deploy completes.",
+							"",
+							"```bash frame=\"none\"",
+							"sst deploy --outputs-file=.env.outputs",
+							"```",
+							"",
+							"The format is based on the extension of the file; `.json`, `.yaml`, or `.env`.",
+						}, "\n"),
+					},
+				},
+			},
 			Examples: []Example{
 				{
 					Content: "sst deploy --stage=production",
@@ -355,27 +538,191 @@ var Root = Command{
 						Short: "Deploy to production",
 					},
 				},
+				{
+					Content: "sst deploy --report=report.xml",
+					Description: Description{
+						Short: "Deploy and write a JUnit report",
+					},
+				},
 			},
 			Run: func(cli *Cli) error {
+				if cli.Bool("all") {
+					return deployAll(cli)
+				}
+				if stages := parseStages(cli.String("stage")); stages != nil {
+					return deployStages(cli, stages)
+				}
+
 				p, err := initProject(cli)
 				if err != nil {
 					return err
 				}
 				defer p.Cleanup()
 
+				interactive := ui.IsInteractive()
 				ui := ui.New(ui.ProgressModeDeploy)
 				defer ui.Destroy()
 				ui.Header(version, p.App().Name, p.App().Stage)
+				var complete *project.CompleteEvent
+				cli.Graceful()
 				err = p.Stack.Run(cli.Context, &project.StackInput{
-					Command: "up",
-					OnEvent: ui.Trigger,
+					Command:     "up",
+					Interrupted: cli.Interrupted(),
+					OnEvent: func(event *project.StackEvent) {
+						if event.CompleteEvent != nil {
+							complete = event.CompleteEvent
+						}
+						ui.Trigger(event)
+					},
+					Confirm: func(changes []project.DestructiveChange) bool {
+						if cli.Bool("yes") {
+							return true
+						}
+						return ui.Confirm(changes)
+					},
 				})
+				if err == project.ErrStackCancelled && !cli.Bool("yes") && !interactive {
+					return util.NewReadableError(err, "Protected resources will be replaced or deleted. Pass in --yes to deploy anyway.")
+				}
+				if path := cli.String("report"); path != "" {
+					if err := ui.Report().Write(path); err != nil {
+						return util.NewReadableError(err, "Could not write report")
+					}
+				}
 				if err != nil {
 					return err
 				}
+				if path := cli.String("outputs-file"); path != "" && complete != nil {
+					return writeOutputs(complete.Outputs, "", path)
+				}
 				return nil
 			},
 		},
+		{
+			Name: "outputs",
+			Description: Description{
+				Short: "Print the outputs of your app",
+				Long: strings.Join([]string{
+					"Prints the outputs of your app from the last deploy, without deploying it again.",
+					"",
+					"```bash frame=\"none\"",
+					"sst outputs --stage=production",
+					"```",
+					"",
+					"By default it prints them as JSON. You can also print them as a `dotenv` or `yaml` file.",
+					"",
+					"```bash frame=\"none\"",
+					"sst outputs --format=dotenv",
+					"```",
+					"",
+					"Or write them to a file, so they can be used by your frontend build.",
+					"",
+					"```bash frame=\"none\"",
+					"sst outputs --out=.env.outputs",
+					"```",
+				}, "\n"),
+			},
+			Flags: []Flag{
+				formatFlag,
+				outFlag,
+			},
+			Examples: []Example{
+				{
+					Content: "sst outputs --format=dotenv --out=.env.outputs",
+					Description: Description{
+						Short: "Write the outputs to a dotenv file",
+					},
+				},
+			},
+			Run: CmdOutputs,
+		},
+		{
+			Name: "graph",
+			Description: Description{
+				Short: "Print the resource graph of your app",
+				Long: strings.Join([]string{
+					"Prints how the resources in your app are wired together, based on the last deploy.",
+					"",
+					"```bash frame=\"none\"",
+					"sst graph --format=mermaid",
+					"```",
+					"",
+					"Dependencies are drawn as solid lines and parent to child relations as dashed lines. It can be printed as `dot`, `mermaid`, or `json`.",
+					"",
+					"To only view the components in your app, collapse the resources into the component they belong to.",
+					"",
+					"```bash frame=\"none\"",
+					"sst graph --collapse",
+					"```",
+					"",
+					"Or filter the graph by type.",
+					"",
+					"```bash frame=\"none\"",
+					"sst graph --type=sst:aws:Function,aws:iam",
+					"```",
+				}, "\n"),
+			},
+			Flags: []Flag{
+				formatFlag,
+				{
+					Name: "type",
+					Type: "string",
+					Description: Description{
+						Short: "Only include resources of these types",
+						Long:  "A comma separated list of resource types to include. A resource is included if its type starts with one of them.",
+					},
+				},
+				{
+					Name: "collapse",
+					Type: "bool",
+					Description: Description{
+						Short: "Collapse resources into their components",
+						Long:  "Collapse every resource into the top level component it belongs to.",
+					},
+				},
+				outFlag,
+			},
+			Examples: []Example{
+				{
+					Content: "sst graph --collapse --format=dot | dot -Tsvg > graph.svg",
+					Description: Description{
+						Short: "Render the components in your app as an SVG",
+					},
+				},
+			},
+			Run: CmdGraph,
+		},
+		{
+			Name: "history",
+			Description: Description{
+				Short: "List the past deploys of a stage",
+				Long: strings.Join([]string{
+					"Lists the past deploys, removes, and refreshes of a stage. The history is encrypted and stored in your `home` provider.",
+					"",
+					"```bash frame=\"none\"",
+					"sst history --stage=production",
+					"```",
+					"",
+					"Each entry records who ran it, the version of the CLI, the git commit, how long it took, the resources that changed, and any errors.",
+					"",
+					"To view the details of an entry, pass in its number.",
+					"",
+					"```bash frame=\"none\"",
+					"sst history 3 --stage=production",
+					"```",
+				}, "\n"),
+			},
+			Args: []Argument{
+				{
+					Name: "entry",
+					Description: Description{
+						Short: "The number of the entry to show",
+						Long:  "The number of the entry to show.",
+					},
+				},
+			},
+			Run: CmdHistory,
+		},
 		{
 			Name: "add",
 			Description: Description{
@@ -839,17 +1186,57 @@ var Root = Command{
 					"```bash frame=\"none\" frame=\"none\"",
 					"sst remove --stage=production",
 					"```",
+					"",
+					"To see which resources will be removed and which will be retained, without removing anything.",
+					"",
+					"```bash frame=\"none\" frame=\"none\"",
+					"sst remove --dry-run",
+					"```",
+					"",
+					"Once removed, the CLI lists the resources that were retained along with their IDs, so you can clean them up later.",
+					"",
+					"If the stage is marked with `protect` in your `sst.config.ts`, you'll need to pass in `--i-know` and confirm the name of the stage.",
 				}, "\n"),
 			},
+			Flags: []Flag{
+				iKnowFlag,
+				{
+					Name: "dry-run",
+					Type: "bool",
+					Description: Description{
+						Short: "List what would be removed and retained",
+						Long: strings.Join([]string{
+							"List the resources that would be removed and the ones that would be retained based on your `removal` setting, without removing anything.",
+							"",
+							"```bash frame=\"none\"",
+							"sst remove --stage=production --dry-run",
+							"```",
+						}, "\n"),
+					},
+				},
+			},
 			Run: func(cli *Cli) error {
 				p, err := initProject(cli)
 				if err != nil {
 					return err
 				}
 				defer p.Cleanup()
+				if cli.Bool("dry-run") {
+					deployment, err := p.Stack.Deployment(cli.Context)
+					if err != nil {
+						return err
+					}
+					removed, retained := project.PartitionRetained(deployment.Resources)
+					ui.New(ui.ProgressModeRemove).PrintRemovePlan(removed, retained)
+					return nil
+				}
+				if err := checkProtected(cli, p, "remove"); err != nil {
+					return err
+				}
 				ui := ui.New(ui.ProgressModeRemove)
 				defer ui.Destroy()
 				ui.Header(version, p.App().Name, p.App().Stage)
+				cli.Graceful()
 				err = p.Stack.Run(cli.Context, &project.StackInput{
 					Command: "destroy",
 					OnEvent: ui.Trigger,
@@ -860,6 +1247,43 @@ var Root = Command{
 				return nil
 			},
 		},
+		{
+			Name: "bootstrap",
+			Description: Description{
+				Short: "Create the resources your home provider stores state in",
+				Long: strings.Join([]string{
+					"Creates the resources your `home` provider uses to store the state of your apps. For AWS this is an S3 bucket for the state, an S3 bucket for assets, and an SSM parameter that points to them. For Cloudflare it is an R2 bucket.",
+					"",
+					"```bash frame=\"none\"",
+					"sst bootstrap",
+					"```",
+					"",
+					"This normally happens the first time you deploy. Running it yourself lets you review what will be created, and customize it with the `bootstrap` arg of the provider.",
+					"",
+					"```ts title=\"sst.config.ts\"",
+					"{",
+					"  providers: {",
+					"    aws: {",
+					"      bootstrap: {",
+					"        stateBucket: \"acme-sst-state\",",
+					"        kmsKey: \"alias/sst\",",
+					"        tags: { team: \"platform\" }",
+					"      }",
+					"    }",
+					"  }",
+					"}",
+					"```",
+					"",
+					"Set `permissionsBoundary` to the ARN of a policy to use it as the permissions boundary of the IAM roles your apps create.",
+					"",
+					"If the bootstrap was created by an older version of the CLI, this lists the migrations that bring it up to date. Other commands create a missing bootstrap but never migrate an existing one, they only warn that it's outdated.",
+				}, "\n"),
+			},
+			Flags: []Flag{
+				yesFlag,
+			},
+			Run: CmdBootstrap,
+		},
 		{
 			Name: "unlock",
 			Description: Description{
@@ -870,14 +1294,22 @@ var Root = Command{
 					"However, if something unexpectedly kills the `sst deploy` process, or if you manage to run `sst deploy` concurrently, the lock might not be released.",
 					"",
 					"This should not usually happen, but it can prevent you from deploying. You can run `sst cancel` to release the lock.",
+					"",
+					"On a stage that is marked with `protect`, you'll need to pass in `--i-know`, since removing the lock of a deploy that is still running can corrupt the state.",
 				}, "\n"),
 			},
+			Flags: []Flag{
+				iKnowFlag,
+			},
 			Run: func(cli *Cli) error {
 				p, err := initProject(cli)
 				if err != nil {
 					return err
 				}
 				defer p.Cleanup()
+				if err := checkProtected(cli, p, "unlock"); err != nil {
+					return err
+				}
 
 				err = p.Stack.Cancel()
 				if err != nil {
@@ -1014,6 +1446,7 @@ var Root = Command{
 						Short: "The parent resource",
 					},
 				},
+				iKnowFlag,
 			},
 			Run: func(cli *Cli) error {
 				resourceType := cli.Positional(0)
@@ -1026,6 +1459,9 @@ var Root = Command{
 					return err
 				}
 				defer p.Cleanup()
+				if err := checkProtected(cli, p, "import into"); err != nil {
+					return err
+				}
 
 				err = p.Stack.Import(cli.Context, &project.ImportOptions{
 					Type:   resourceType,
@@ -1089,6 +1525,7 @@ var Root = Command{
 				ui := ui.New(ui.ProgressModeRefresh)
 				defer ui.Destroy()
 				ui.Header(version, p.App().Name, p.App().Stage)
+				cli.Graceful()
 				err = p.Stack.Run(cli.Context, &project.StackInput{
 					Command: "refresh",
 					OnEvent: ui.Trigger,
@@ -1111,12 +1548,18 @@ var Root = Command{
 					Description: Description{
 						Short: "Edit the state of your deployment",
 					},
+					Flags: []Flag{
+						iKnowFlag,
+					},
 					Run: func(cli *Cli) error {
 						p, err := initProject(cli)
 						if err != nil {
 							return err
 						}
 						defer p.Cleanup()
+						if err := checkProtected(cli, p, "edit the state of"); err != nil {
+							return err
+						}
 
 						err = p.Stack.Lock()
 						if err != nil {
@@ -1145,13 +1588,71 @@ var Root = Command{
 						return p.Stack.PushState()
 					},
 				},
+				{
+					Name: "push",
+					Description: Description{
+						Short: "Replace the state of your deployment with a file",
+						Long: strings.Join([]string{
+							"Replace the state of your deployment with a local copy. Use this to recover after a force exit, with the copy that was saved in `.sst/recovery`.",
+							"",
+							"```bash frame=\"none\"",
+							"sst state push .sst/recovery/production-1700000000.json",
+							"```",
+						}, "\n"),
+					},
+					Args: []Argument{
+						{
+							Name:     "file",
+							Required: true,
+							Description: Description{
+								Short: "The state file to push",
+							},
+						},
+					},
+					Flags: []Flag{
+						iKnowFlag,
+					},
+					Run: func(cli *Cli) error {
+						file := cli.Positional(0)
+						p, err := initProject(cli)
+						if err != nil {
+							return err
+						}
+						defer p.Cleanup()
+						if err := checkProtected(cli, p, "replace the state of"); err != nil {
+							return err
+						}
+
+						err = p.Stack.Lock()
+						if err != nil {
+							return util.NewReadableError(err, "Could not lock state")
+						}
+						defer p.Stack.Unlock()
+
+						err = p.Stack.RestoreState(file)
+						if err != nil {
+							return util.NewReadableError(err, "Could not push state")
+						}
+						ui.Success(fmt.Sprintf("Pushed state for stage \"%s\"", p.App().Stage))
+						return nil
+					},
+				},
 			},
 		},
 	},
 }
 
-func (c *Command) registerFlags(parsed map[string]interface{}) {
+// registerFlags registers the flags of the command and its children. Flags
+// are global, so commands can share a flag only if they define it the same way.
+func (c *Command) registerFlags(parsed map[string]interface{}, defined map[string]Flag) error {
 	for _, f := range c.Flags {
+		if existing, ok := defined[f.Name]; ok {
+			if existing != f {
+				return fmt.Errorf("flag --%s is defined differently by more than one command", f.Name)
+			}
+			continue
+		}
+		defined[f.Name] = f
 		if f.Type == "string" {
 			parsed[f.Name] = flag.String(f.Name, "", "")
 		}
@@ -1161,8 +1662,11 @@ func (c *Command) registerFlags(parsed map[string]interface{}) {
 		}
 	}
 	for _, child := range c.Children {
-		child.registerFlags(parsed)
+		if err := child.registerFlags(parsed, defined); err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
 func init() {
@@ -1175,12 +1679,26 @@ type Cli struct {
 	path      CommandPath
 	Context   context.Context
 	cancel    context.CancelFunc
+	graceful  atomic.Bool
+	// interrupted is closed on the first Ctrl-C of a graceful command
+	interrupted chan struct{}
 }
 
 func (c *Cli) Cancel() {
 	c.cancel()
 }
 
+// Graceful makes the first Ctrl-C wait for the running stack command to
+// cancel cleanly, instead of cancelling the context right away.
+func (c *Cli) Graceful() {
+	c.graceful.Store(true)
+}
+
+// Interrupted is closed on the first Ctrl-C of a graceful command.
+func (c *Cli) Interrupted() <-chan struct{} {
+	return c.interrupted
+}
+
 func (c *Cli) String(name string) string {
 	if f, ok := c.flags[name]; ok {
 		return *f.(*string)
@@ -1381,6 +1899,32 @@ func initProject(cli *Cli) (*project.Project, error) {
 		return nil, util.NewReadableError(err, "Could not find stage")
 	}
 
+	return initProjectStage(cli, cfgPath, stage)
+}
+
+func initProjectStage(cli *Cli, cfgPath string, stage string) (*project.Project, error) {
+	p, err := newProjectStage(cli, cfgPath, stage)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.LoadProviders(); err != nil {
+		return nil, util.NewReadableError(err, err.Error())
+	}
+	// an outdated bootstrap is only migrated by sst bootstrap
+	if home, ok := p.Backend().(*provider.AwsProvider); ok && home.BootstrapOutdated() {
+		ui.Warn("The bootstrap was created by an older version of sst. Run `sst bootstrap` to update it.")
+	}
+
+	app := p.App()
+	slog.Info("loaded config", "app", app.Name, "stage", app.Stage)
+
+	return p, nil
+}
+
+// newProjectStage evaluates the config and installs the platform, without
+// loading the providers.
+func newProjectStage(cli *Cli, cfgPath string, stage string) (*project.Project, error) {
 	p, err := project.New(&project.ProjectConfig{
 		Version: version,
 		Stage:   stage,
@@ -1390,20 +1934,24 @@ func initProject(cli *Cli) (*project.Project, error) {
 		return nil, err
 	}
 
-	_, err = logFile.Seek(0, 0)
-	if err != nil {
-		return nil, err
-	}
-	nextLogFile, err := os.Create(filepath.Join(p.PathWorkingDir(), "sst.log"))
-	if err != nil {
-		return nil, util.NewReadableError(err, "Could not create log file")
-	}
-	_, err = io.Copy(nextLogFile, logFile)
-	if err != nil {
-		return nil, util.NewReadableError(err, "Could not copy log file")
+	// when deploying several stages the log file was already moved
+	logPath := filepath.Join(p.PathWorkingDir(), "sst.log")
+	if logFile.Name() != logPath {
+		_, err = logFile.Seek(0, 0)
+		if err != nil {
+			return nil, err
+		}
+		nextLogFile, err := os.Create(logPath)
+		if err != nil {
+			return nil, util.NewReadableError(err, "Could not create log file")
+		}
+		_, err = io.Copy(nextLogFile, logFile)
+		if err != nil {
+			return nil, util.NewReadableError(err, "Could not copy log file")
+		}
+		logFile = nextLogFile
+		configureLog(cli)
 	}
-	logFile = nextLogFile
-	configureLog(cli)
 
 	spin := spinner.New(spinner.CharSets[14], 100*time.Millisecond)
 	defer spin.Stop()
@@ -1425,13 +1973,6 @@ func initProject(cli *Cli) (*project.Project, error) {
 		}
 	}
 
-	if err := p.LoadProviders(); err != nil {
-		return nil, util.NewReadableError(err, err.Error())
-	}
-
-	app := p.App()
-	slog.Info("loaded config", "app", app.Name, "stage", app.Stage)
-
 	return p, nil
 }
 
@@ -1448,8 +1989,33 @@ func configureLog(cli *Cli) {
 	)
 }
 
+func configureColor(cli *Cli) {
+	if cli.Bool("color") {
+		color.NoColor = false
+		return
+	}
+	if ui.IsPlain() {
+		color.NoColor = true
+	}
+}
+
 func getStage(cli *Cli, cfgPath string) (string, error) {
 	stage := cli.String("stage")
+	strategy := cli.String("stage-strategy")
+	if strategy == "" {
+		strategy = os.Getenv("SST_STAGE_STRATEGY")
+	}
+	if stage == "" && strategy != "" {
+		username := ""
+		if u, err := user.Current(); err == nil {
+			username = u.Username
+		}
+		derived, err := project.DeriveStage(cfgPath, strategy, username)
+		if err != nil {
+			return "", util.NewReadableError(err, "Could not derive stage: "+err.Error())
+		}
+		stage = derived
+	}
 	if stage == "" {
 		stage = project.LoadPersonalStage(cfgPath)
 		if stage == "" {
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/joho/godotenv"
+	"github.com/sst/ion/internal/util"
+	"github.com/sst/ion/pkg/project"
+	"gopkg.in/yaml.v3"
+)
+
+func CmdOutputs(cli *Cli) error {
+	p, err := initProject(cli)
+	if err != nil {
+		return err
+	}
+	defer p.Cleanup()
+
+	outputs, err := p.Stack.Outputs(cli.Context)
+	if err != nil {
+		if err == project.ErrStageNotFound {
+			return err
+		}
+		return util.NewReadableError(err, "Could not read outputs")
+	}
+	return writeOutputs(outputs, cli.String("format"), cli.String("out"))
+}
+
+// writeOutputs prints the outputs or writes them to a file. If no format is
+// passed in, it is inferred from the file extension.
+func writeOutputs(outputs map[string]interface{}, format string, out string) error {
+	if format == "" {
+		format = outputsFormat(out)
+	}
+	data, err := formatOutputs(outputs, format)
+	if err != nil {
+		return err
+	}
+	if out == "" {
+		fmt.Print(string(data))
+		return nil
+	}
+	err = os.MkdirAll(filepath.Dir(out), 0755)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(out, data, 0644)
+	if err != nil {
+		return util.NewReadableError(err, "Could not write outputs to "+out)
+	}
+	return nil
+}
+
+func outputsFormat(path string) string {
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml":
+		return "yaml"
+	case ".env":
+		return "dotenv"
+	}
+	if strings.HasPrefix(filepath.Base(path), ".env") {
+		return "dotenv"
+	}
+	return "json"
+}
+
+func formatOutputs(outputs map[string]interface{}, format string) ([]byte, error) {
+	switch format {
+	case "json":
+		data, err := json.MarshalIndent(outputs, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(data, '\n'), nil
+	case "yaml":
+		return yaml.Marshal(outputs)
+	case "dotenv":
+		env := map[string]string{}
+		for key, value := range outputs {
+			if str, ok := value.(string); ok {
+				env[key] = str
+				continue
+			}
+			data, err := json.Marshal(value)
+			if err != nil {
+				return nil, err
+			}
+			env[key] = string(data)
+		}
+		data, err := godotenv.Marshal(env)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(data + "\n"), nil
+	}
+	return nil, util.NewReadableError(nil, fmt.Sprintf("Unknown format \"%s\", use json, dotenv, or yaml", format))
+}
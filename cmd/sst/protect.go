@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/sst/ion/cmd/sst/ui"
+	"github.com/sst/ion/internal/util"
+	"github.com/sst/ion/pkg/project"
+)
+
+var iKnowFlag = Flag{
+	Name: "i-know",
+	Type: "bool",
+	Description: Description{
+		Short: "Run against a protected stage",
+		Long: strings.Join([]string{
+			"Stages that are marked with `protect` in your `sst.config.ts` refuse to run this command.",
+			"",
+			"Pass this in to run it anyway. You'll also be asked to type in the name of the stage to confirm.",
+		}, "\n"),
+	},
+}
+
+// checkProtected refuses to continue on a protected stage unless the
+// override flag is passed in and the user types in the stage name.
+func checkProtected(cli *Cli, p *project.Project, action string) error {
+	app := p.App()
+	if !app.IsStageProtected() {
+		return nil
+	}
+	if !cli.Bool("i-know") {
+		return util.NewReadableError(nil, fmt.Sprintf("The stage \"%s\" is protected. Pass in --i-know to %s it.", app.Stage, action))
+	}
+	if !ui.IsInteractive() {
+		return util.NewReadableError(nil, fmt.Sprintf("The stage \"%s\" is protected. It needs to be confirmed in an interactive terminal.", app.Stage))
+	}
+	color.New(color.FgYellow, color.Bold).Print("!")
+	color.New(color.FgWhite, color.Bold).Printf("  The stage \"%s\" is protected. Type in its name to %s it: ", app.Stage, action)
+	reader := bufio.NewReader(os.Stdin)
+	input, _ := reader.ReadString('\n')
+	if strings.TrimSpace(input) != app.Stage {
+		return util.NewReadableError(nil, "The stage name did not match")
+	}
+	fmt.Println()
+	return nil
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/sst/ion/cmd/sst/ui"
+	"github.com/sst/ion/internal/util"
+	"github.com/sst/ion/pkg/project"
+)
+
+const defaultConcurrency = 4
+
+// deployTarget is one of the projects deployed by a single command, with the
+// indexes of the targets that have to be deployed before it.
+type deployTarget struct {
+	name    string
+	project *project.Project
+	deps    []int
+}
+
+// parseStages splits a comma separated list of stages. It returns nil if
+// only one stage was passed in.
+func parseStages(input string) []string {
+	if !strings.Contains(input, ",") {
+		return nil
+	}
+	stages := []string{}
+	for _, item := range strings.Split(input, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			stages = append(stages, item)
+		}
+	}
+	return stages
+}
+
+func parseConcurrency(cli *Cli) (int, error) {
+	if cli.String("report") != "" || cli.String("outputs-file") != "" {
+		return 0, util.NewReadableError(nil, "The --report and --outputs-file flags can only be used when deploying a single stage")
+	}
+	value := cli.String("concurrency")
+	if value == "" {
+		return defaultConcurrency, nil
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed < 1 {
+		return 0, util.NewReadableError(err, fmt.Sprintf("Invalid concurrency \"%s\"", value))
+	}
+	return parsed, nil
+}
+
+// deployStages deploys the stages in parallel, with at most --concurrency of
+// them running at the same time.
+func deployStages(cli *Cli, stages []string) error {
+	concurrency, err := parseConcurrency(cli)
+	if err != nil {
+		return err
+	}
+	cfgPath, err := project.Discover()
+	if err != nil {
+		return util.NewReadableError(err, "Could not find sst.config.ts")
+	}
+
+	// the config is evaluated and the platform is installed one stage at a
+	// time, only the deploys run in parallel
+	targets := []deployTarget{}
+	defer func() { cleanupTargets(targets) }()
+	for _, stage := range stages {
+		p, err := initProjectStage(cli, cfgPath, stage)
+		if err != nil {
+			return err
+		}
+		targets = append(targets, deployTarget{name: stage, project: p})
+	}
+
+	u := ui.New(ui.ProgressModeDeploy)
+	u.Header(version, targets[0].project.App().Name, strings.Join(stages, ", "))
+	u.Destroy()
+	return runDeploys(cli, targets, concurrency)
+}
+
+func cleanupTargets(targets []deployTarget) {
+	for _, target := range targets {
+		target.project.Cleanup()
+	}
+}
+
+// runDeploys deploys every target once the ones it depends on are deployed,
+// with at most concurrency of them running at the same time. Targets that
+// depend on a failed one are skipped.
+func runDeploys(cli *Cli, targets []deployTarget, concurrency int) error {
+	width := 0
+	for _, target := range targets {
+		width = max(width, len(target.name))
+	}
+
+	cli.Graceful()
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	failed := make([]bool, len(targets))
+	done := make([]chan struct{}, len(targets))
+	for index := range targets {
+		done[index] = make(chan struct{})
+	}
+	semaphore := make(chan struct{}, concurrency)
+	for index, target := range targets {
+		wg.Add(1)
+		go func(index int, target deployTarget) {
+			defer wg.Done()
+			defer close(done[index])
+			out := ui.NewPrefixed(target.name, index, width, &lock)
+
+			for _, dep := range target.deps {
+				<-done[dep]
+				if failed[dep] {
+					failed[index] = true
+					out.Error(fmt.Sprintf("Skipped, %s failed to deploy", targets[dep].name))
+					return
+				}
+			}
+
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+			err := target.project.Stack.Run(cli.Context, &project.StackInput{
+				Command:     "up",
+				Interrupted: cli.Interrupted(),
+				OnEvent:     out.Trigger,
+				Confirm: func(changes []project.DestructiveChange) bool {
+					return out.Confirm(changes, cli.Bool("yes"))
+				},
+			})
+			if err == nil {
+				return
+			}
+			failed[index] = true
+			switch err {
+			case project.ErrStackRunFailed:
+				// the errors were printed with the complete event
+			case project.ErrStackCancelled:
+				out.Error("Protected resources will be replaced or deleted. Pass in --yes to deploy anyway.")
+			default:
+				if msg := TransformError(err).Error(); msg != "" {
+					out.Error(msg)
+				}
+			}
+		}(index, target)
+	}
+	wg.Wait()
+
+	names := []string{}
+	for index, target := range targets {
+		if failed[index] {
+			names = append(names, target.name)
+		}
+	}
+	if len(names) > 0 {
+		return util.NewReadableError(nil, "Failed to deploy: "+strings.Join(names, ", "))
+	}
+	return nil
+}
+
+// deployAll deploys every app in the repo to the same stage. Apps that
+// reference another app with $ref are deployed after it, the rest run in
+// parallel.
+func deployAll(cli *Cli) error {
+	concurrency, err := parseConcurrency(cli)
+	if err != nil {
+		return err
+	}
+	configs, err := project.DiscoverAll()
+	if err != nil {
+		return util.NewReadableError(err, "Could not find sst.config.ts files")
+	}
+	if len(configs) == 0 {
+		return util.NewReadableError(nil, "Could not find any sst.config.ts files")
+	}
+
+	// the personal stage is read from the app in the current directory
+	cfgPath, err := project.Discover()
+	if err != nil {
+		cfgPath = configs[0]
+	}
+	stage := cli.String("stage")
+	if parseStages(stage) != nil {
+		return util.NewReadableError(nil, "The --all flag can only be used with a single stage")
+	}
+	stage, err = getStage(cli, cfgPath)
+	if err != nil {
+		return util.NewReadableError(err, "Could not find stage")
+	}
+
+	targets := []deployTarget{}
+	defer func() { cleanupTargets(targets) }()
+	indexes := map[string]int{}
+	refs := map[string][]string{}
+	for _, cfgPath := range configs {
+		p, err := initProjectStage(cli, cfgPath, stage)
+		if err != nil {
+			return err
+		}
+		name := p.App().Name
+		if existing, ok := indexes[name]; ok {
+			return util.NewReadableError(nil, fmt.Sprintf("The app \"%s\" is defined in both %s and %s", name, project.RelativeConfig(targets[existing].project.PathConfig()), project.RelativeConfig(cfgPath)))
+		}
+		appRefs, err := project.ConfigRefs(cfgPath, stage)
+		if err != nil {
+			return err
+		}
+		indexes[name] = len(targets)
+		refs[name] = appRefs
+		targets = append(targets, deployTarget{name: name, project: p})
+	}
+
+	order, err := project.SortApps(refs)
+	if err != nil {
+		return util.NewReadableError(err, err.Error())
+	}
+	for index := range targets {
+		for _, ref := range refs[targets[index].name] {
+			if dep, ok := indexes[ref]; ok && dep != index {
+				targets[index].deps = append(targets[index].deps, dep)
+			}
+		}
+	}
+
+	u := ui.New(ui.ProgressModeDeploy)
+	u.Header(version, strings.Join(order, ", "), stage)
+	u.Destroy()
+	return runDeploys(cli, targets, concurrency)
+}
@@ -0,0 +1,170 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/apitype"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource"
+	"github.com/sst/ion/pkg/project"
+)
+
+// Prefixed prints the progress of one of several stages that run at the same
+// time. Every line is written at once and starts with the stage, so the
+// output of the stages can be interleaved.
+type Prefixed struct {
+	stage  string
+	color  color.Attribute
+	width  int
+	plain  bool
+	lock   *sync.Mutex
+	timing map[string]time.Time
+}
+
+func NewPrefixed(stage string, index int, width int, lock *sync.Mutex) *Prefixed {
+	return &Prefixed{
+		stage:  stage,
+		color:  COLORS[index%len(COLORS)],
+		width:  width,
+		plain:  IsPlain(),
+		lock:   lock,
+		timing: map[string]time.Time{},
+	}
+}
+
+func (p *Prefixed) println(lines ...string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	// the prefix is colored when printed, after --color is applied
+	prefix := color.New(p.color, color.Bold).Sprintf("%-*s", p.width, p.stage) + " | "
+	for _, line := range lines {
+		fmt.Println(prefix + line)
+	}
+}
+
+func (p *Prefixed) printEvent(barColor color.Attribute, label string, message string) {
+	p.println(bar(p.plain, barColor) + color.New(color.FgHiBlack).Sprint(fmt.Sprintf("%-11s", label), " ", strings.TrimSpace(message)))
+}
+
+func formatResource(urn string) string {
+	if urn == "" {
+		return ""
+	}
+	parsed := resource.URN(urn)
+	name := parsed.Name()
+	typeName := parsed.Type().DisplayName()
+	splits := strings.SplitN(name, ".", 2)
+	if len(splits) > 1 {
+		name = splits[0]
+		typeName = strings.ReplaceAll(splits[1], ".", ":")
+	}
+	return name + " " + typeName
+}
+
+var progressLabels = map[apitype.OpType]string{
+	apitype.OpCreate:            "Creating",
+	apitype.OpUpdate:            "Updating",
+	apitype.OpCreateReplacement: "Creating",
+	apitype.OpReplace:           "Creating",
+	apitype.OpDelete:            "Deleting",
+	apitype.OpDeleteReplaced:    "Deleting",
+	apitype.OpRefresh:           "Refreshing",
+}
+
+var doneLabels = map[apitype.OpType]string{
+	apitype.OpCreate:            "Created",
+	apitype.OpUpdate:            "Updated",
+	apitype.OpCreateReplacement: "Created",
+	apitype.OpReplace:           "Created",
+	apitype.OpDelete:            "Deleted",
+	apitype.OpDeleteReplaced:    "Deleted",
+	apitype.OpRefresh:           "Refreshed",
+}
+
+func (p *Prefixed) Trigger(evt *project.StackEvent) {
+	if evt.ConcurrentUpdateEvent != nil {
+		p.printEvent(color.FgRed, "Locked", "A concurrent update was detected on the stack. Run `sst unlock` to delete the lock file and retry.")
+	}
+
+	if evt.StackCommandEvent != nil {
+		p.printEvent(color.FgYellow, "Deploying", "")
+	}
+
+	if evt.RetryEvent != nil {
+		p.printEvent(color.FgYellow, "Retrying", fmt.Sprintf("attempt %d of %d in %s", evt.RetryEvent.Attempt, evt.RetryEvent.Max, evt.RetryEvent.Delay))
+	}
+
+	if evt.HookEvent != nil {
+		p.printEvent(color.FgBlue, "Hook", evt.HookEvent.Name+" "+evt.HookEvent.Command)
+	}
+
+	if evt.StdOutEvent != nil {
+		p.println(evt.StdOutEvent.Text)
+	}
+
+	if evt.ResourcePreEvent != nil {
+		metadata := evt.ResourcePreEvent.Metadata
+		p.timing[metadata.URN] = time.Now()
+		if label, ok := progressLabels[metadata.Op]; ok && metadata.Type != "pulumi:pulumi:Stack" {
+			p.printEvent(color.FgYellow, label, formatResource(metadata.URN))
+		}
+	}
+
+	if evt.ResOutputsEvent != nil {
+		metadata := evt.ResOutputsEvent.Metadata
+		if label, ok := doneLabels[metadata.Op]; ok && metadata.Type != "pulumi:pulumi:Stack" {
+			duration := time.Since(p.timing[metadata.URN]).Round(100 * time.Millisecond)
+			p.printEvent(color.FgGreen, label, formatResource(metadata.URN)+" ("+duration.String()+")")
+		}
+	}
+
+	if evt.DiagnosticEvent != nil && evt.DiagnosticEvent.Severity == "error" && evt.DiagnosticEvent.URN != "" {
+		lines := parseError(evt.DiagnosticEvent.Message)
+		if len(lines) > 0 {
+			p.printEvent(color.FgRed, "Error", formatResource(evt.DiagnosticEvent.URN)+" "+lines[0])
+		}
+	}
+
+	if evt.CompleteEvent != nil {
+		complete := evt.CompleteEvent
+		if len(complete.Errors) == 0 && complete.Finished {
+			p.println(color.New(color.FgGreen, color.Bold).Sprint(IconCheck) + color.New(color.FgWhite, color.Bold).Sprint("  Complete"))
+			for key, value := range complete.Outputs {
+				p.println("   " + color.New(color.FgHiBlack, color.Bold).Sprint(key+": ") + fmt.Sprint(value))
+			}
+			return
+		}
+		if len(complete.Errors) == 0 {
+			p.println(color.New(color.FgRed, color.Bold).Sprint(IconX) + color.New(color.FgWhite, color.Bold).Sprint("  Interrupted"))
+			return
+		}
+		p.println(color.New(color.FgRed, color.Bold).Sprint(IconX) + color.New(color.FgWhite, color.Bold).Sprint("  Failed"))
+		for _, item := range complete.Errors {
+			if item.URN != "" {
+				p.println("   " + color.New(color.FgRed, color.Bold).Sprint(formatResource(item.URN)))
+			}
+			for _, line := range parseError(item.Message) {
+				p.println("   " + line)
+			}
+		}
+	}
+}
+
+// Error prints an error that stopped the stage before it could complete.
+func (p *Prefixed) Error(msg string) {
+	p.println(color.New(color.FgRed, color.Bold).Sprint(IconX) + "  " + msg)
+}
+
+// Confirm lists the protected resources that would be replaced or deleted.
+// Stages that run at the same time cannot prompt, so it only returns true if
+// the changes were already approved.
+func (p *Prefixed) Confirm(changes []project.DestructiveChange, approved bool) bool {
+	p.printEvent(color.FgYellow, "Protected", fmt.Sprintf("%d protected resources will be replaced or deleted", len(changes)))
+	for _, change := range changes {
+		p.println("   " + string(change.Op) + " " + formatResource(change.URN))
+	}
+	return approved
+}
@@ -0,0 +1,323 @@
+package ui
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/apitype"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource"
+)
+
+const reportSlowest = 5
+
+type Report struct {
+	Mode         ProgressMode     `json:"mode"`
+	Duration     float64          `json:"duration"`
+	Operations   map[string]int   `json:"operations"`
+	Slowest      []ReportResource `json:"slowest"`
+	CriticalPath []ReportResource `json:"criticalPath"`
+	Resources    []ReportResource `json:"resources"`
+	Errors       []ReportError    `json:"errors"`
+}
+
+type ReportResource struct {
+	URN      string  `json:"urn"`
+	Name     string  `json:"name"`
+	Type     string  `json:"type"`
+	Op       string  `json:"op"`
+	Duration float64 `json:"duration"`
+}
+
+type ReportError struct {
+	URN     string `json:"urn,omitempty"`
+	Message string `json:"message"`
+}
+
+type reportResult struct {
+	op       apitype.OpType
+	duration time.Duration
+}
+
+// Report builds a summary of the last stack command from the timings
+// collected while it was running.
+func (u *UI) Report() *Report {
+	result := &Report{
+		Mode:         u.mode,
+		Operations:   map[string]int{},
+		Slowest:      []ReportResource{},
+		CriticalPath: []ReportResource{},
+		Resources:    []ReportResource{},
+		Errors:       []ReportError{},
+	}
+	if !u.started.IsZero() {
+		result.Duration = u.finished.Sub(u.started).Seconds()
+	}
+
+	resources := map[string]ReportResource{}
+	for urn, item := range u.results {
+		parsed := resource.URN(urn)
+		next := ReportResource{
+			URN:      urn,
+			Name:     parsed.Name(),
+			Type:     string(parsed.Type()),
+			Op:       string(item.op),
+			Duration: item.duration.Seconds(),
+		}
+		resources[urn] = next
+		result.Resources = append(result.Resources, next)
+		result.Operations[next.Op]++
+	}
+	sort.Slice(result.Resources, func(i, j int) bool {
+		return result.Resources[i].Duration > result.Resources[j].Duration
+	})
+
+	for _, item := range result.Resources {
+		if len(result.Slowest) == reportSlowest {
+			break
+		}
+		if !u.custom(item.URN) {
+			continue
+		}
+		result.Slowest = append(result.Slowest, item)
+	}
+
+	for _, urn := range u.criticalPath() {
+		if item, ok := resources[urn]; ok {
+			result.CriticalPath = append(result.CriticalPath, item)
+		}
+	}
+
+	if u.complete != nil {
+		for _, item := range u.complete.Errors {
+			result.Errors = append(result.Errors, ReportError{
+				URN:     item.URN,
+				Message: strings.Join(parseError(item.Message), "\n"),
+			})
+		}
+	}
+	return result
+}
+
+func (u *UI) custom(urn string) bool {
+	if u.complete == nil {
+		return true
+	}
+	for _, item := range u.complete.Resources {
+		if string(item.URN) == urn {
+			return item.Custom
+		}
+	}
+	return true
+}
+
+// criticalPath returns the chain of resources with the longest combined
+// duration, following both dependency and parent edges. Component resources
+// are not counted since their duration spans their children.
+func (u *UI) criticalPath() []string {
+	if u.complete == nil {
+		return []string{}
+	}
+	edges := map[string][]string{}
+	weights := map[string]time.Duration{}
+	for _, item := range u.complete.Resources {
+		urn := string(item.URN)
+		for _, dep := range item.Dependencies {
+			edges[urn] = append(edges[urn], string(dep))
+		}
+		if item.Parent != "" {
+			edges[urn] = append(edges[urn], string(item.Parent))
+		}
+		if item.Custom {
+			weights[urn] = u.results[urn].duration
+		}
+	}
+
+	totals := map[string]time.Duration{}
+	next := map[string]string{}
+	visiting := map[string]bool{}
+	var visit func(urn string) time.Duration
+	visit = func(urn string) time.Duration {
+		if total, ok := totals[urn]; ok {
+			return total
+		}
+		if visiting[urn] {
+			return 0
+		}
+		visiting[urn] = true
+		defer delete(visiting, urn)
+		best := time.Duration(0)
+		for _, dep := range edges[urn] {
+			total := visit(dep)
+			if total > best || next[urn] == "" {
+				best = total
+				next[urn] = dep
+			}
+		}
+		totals[urn] = best + weights[urn]
+		return totals[urn]
+	}
+
+	start := ""
+	for _, item := range u.complete.Resources {
+		urn := string(item.URN)
+		if start == "" || visit(urn) > visit(start) {
+			start = urn
+		}
+	}
+
+	path := []string{}
+	for urn := start; urn != ""; urn = next[urn] {
+		if weights[urn] > 0 {
+			path = append(path, urn)
+		}
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path
+}
+
+func (u *UI) printSummary() {
+	report := u.Report()
+	if len(report.Resources) == 0 {
+		return
+	}
+	fmt.Println()
+	color.New(color.FgHiBlack).Print("   ")
+	color.New(color.FgHiBlack, color.Bold).Print("Took: ")
+	color.New(color.FgWhite).Println(formatSeconds(report.Duration))
+
+	ops := []string{}
+	for op, count := range report.Operations {
+		if op == string(apitype.OpSame) {
+			continue
+		}
+		ops = append(ops, fmt.Sprintf("%d %s", count, op))
+	}
+	sort.Strings(ops)
+	if len(ops) > 0 {
+		color.New(color.FgHiBlack).Print("   ")
+		color.New(color.FgHiBlack, color.Bold).Print("Changes: ")
+		color.New(color.FgWhite).Println(strings.Join(ops, ", "))
+	}
+
+	if len(report.Slowest) > 0 {
+		color.New(color.FgHiBlack).Print("   ")
+		color.New(color.FgHiBlack, color.Bold).Println("Slowest:")
+		for _, item := range report.Slowest {
+			color.New(color.FgHiBlack).Printf("     %-8s", formatSeconds(item.Duration))
+			color.New(color.FgWhite).Println(u.formatURN(item.URN))
+		}
+	}
+
+	if len(report.CriticalPath) > 1 {
+		names := []string{}
+		for _, item := range report.CriticalPath {
+			names = append(names, item.Name)
+		}
+		color.New(color.FgHiBlack).Print("   ")
+		color.New(color.FgHiBlack, color.Bold).Print("Critical path: ")
+		color.New(color.FgWhite).Println(strings.Join(names, " → "))
+	}
+}
+
+func formatSeconds(seconds float64) string {
+	return time.Duration(seconds * float64(time.Second)).Round(100 * time.Millisecond).String()
+}
+
+// Write saves the report to the given path. Files ending in .xml are written
+// in the JUnit format, everything else as JSON.
+func (r *Report) Write(path string) error {
+	var data []byte
+	var err error
+	if strings.HasSuffix(path, ".xml") {
+		data, err = r.junit()
+	} else {
+		data, err = json.MarshalIndent(r, "", "  ")
+	}
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+type junitSuite struct {
+	XMLName  xml.Name    `xml:"testsuite"`
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Time     float64     `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      float64       `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+func (r *Report) junit() ([]byte, error) {
+	suite := junitSuite{
+		Name:  "sst " + string(r.Mode),
+		Time:  r.Duration,
+		Cases: []junitCase{},
+	}
+	failed := map[string]*junitFailure{}
+	for _, item := range r.Errors {
+		lines := strings.SplitN(item.Message, "\n", 2)
+		failed[item.URN] = &junitFailure{
+			Message: lines[0],
+			Text:    item.Message,
+		}
+	}
+	for _, item := range r.Resources {
+		suite.Cases = append(suite.Cases, junitCase{
+			Name:      item.Name,
+			Classname: item.Type,
+			Time:      item.Duration,
+			Failure:   failed[item.URN],
+		})
+		delete(failed, item.URN)
+	}
+	for urn, failure := range failed {
+		name := "sst"
+		classname := ""
+		if urn != "" {
+			name = resource.URN(urn).Name()
+			classname = string(resource.URN(urn).Type())
+		}
+		suite.Cases = append(suite.Cases, junitCase{
+			Name:      name,
+			Classname: classname,
+			Failure:   failure,
+		})
+	}
+	suite.Tests = len(suite.Cases)
+	for _, item := range suite.Cases {
+		if item.Failure != nil {
+			suite.Failures++
+		}
+	}
+	data, err := xml.MarshalIndent(suite, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
@@ -0,0 +1,46 @@
+package ui
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/common/apitype"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource"
+	"github.com/sst/ion/pkg/project"
+)
+
+func TestCriticalPath(t *testing.T) {
+	const prefix = "urn:pulumi:dev::app::"
+	u := New(ProgressModeDeploy)
+	u.results = map[string]reportResult{
+		prefix + "aws:s3/bucket:Bucket::A":             {op: apitype.OpCreate, duration: 2 * time.Second},
+		prefix + "aws:iam/role:Role::B":                {op: apitype.OpCreate, duration: 5 * time.Second},
+		prefix + "aws:lambda/function:Function::C":     {op: apitype.OpCreate, duration: 3 * time.Second},
+		prefix + "aws:cloudfront/distribution:Dist::D": {op: apitype.OpCreate, duration: 4 * time.Second},
+	}
+	u.complete = &project.CompleteEvent{
+		Resources: []apitype.ResourceV3{
+			{URN: resource.URN(prefix + "aws:s3/bucket:Bucket::A"), Custom: true},
+			{URN: resource.URN(prefix + "aws:iam/role:Role::B"), Custom: true},
+			{
+				URN:          resource.URN(prefix + "aws:lambda/function:Function::C"),
+				Custom:       true,
+				Dependencies: []resource.URN{prefix + "aws:s3/bucket:Bucket::A", prefix + "aws:iam/role:Role::B"},
+			},
+			{
+				URN:          resource.URN(prefix + "aws:cloudfront/distribution:Dist::D"),
+				Custom:       true,
+				Dependencies: []resource.URN{prefix + "aws:s3/bucket:Bucket::A"},
+			},
+		},
+	}
+	expected := []string{
+		prefix + "aws:iam/role:Role::B",
+		prefix + "aws:lambda/function:Function::C",
+	}
+	result := u.criticalPath()
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %v, got %v", expected, result)
+	}
+}
@@ -2,12 +2,16 @@ package ui
 
 import (
 	"fmt"
+	"io"
 	"log/slog"
+	"os"
 	"strings"
 	"time"
 
 	"github.com/briandowns/spinner"
 	"github.com/fatih/color"
+	"github.com/manifoldco/promptui"
+	"github.com/mattn/go-isatty"
 	"github.com/pulumi/pulumi/sdk/v3/go/common/apitype"
 	"github.com/pulumi/pulumi/sdk/v3/go/common/resource"
 	"github.com/sst/ion/pkg/project"
@@ -31,6 +35,7 @@ const (
 type UI struct {
 	spinner     *spinner.Spinner
 	mode        ProgressMode
+	plain       bool
 	hasProgress bool
 	pending     map[string]string
 	dedupe      map[string]bool
@@ -41,12 +46,34 @@ type UI struct {
 	colors      map[string]color.Attribute
 	workerTime  map[string]time.Time
 	complete    *project.CompleteEvent
+	results     map[string]reportResult
+	retrying    bool
+	started     time.Time
+	finished    time.Time
+}
+
+// IsPlain reports whether progress should be printed as plain log lines
+// instead of an interactive spinner. This is the case when stdout is not a
+// terminal or when running in CI.
+func IsPlain() bool {
+	return os.Getenv("CI") != "" || !isatty.IsTerminal(os.Stdout.Fd())
+}
+
+// IsInteractive reports whether the user can be prompted for input.
+func IsInteractive() bool {
+	return !IsPlain() && isatty.IsTerminal(os.Stdin.Fd())
 }
 
 func New(mode ProgressMode) *UI {
+	plain := IsPlain()
+	options := []spinner.Option{}
+	if plain {
+		options = append(options, spinner.WithWriter(io.Discard))
+	}
 	result := &UI{
-		spinner:    spinner.New(spinner.CharSets[14], 100*time.Millisecond),
+		spinner:    spinner.New(spinner.CharSets[14], 100*time.Millisecond, options...),
 		mode:       mode,
+		plain:      plain,
 		colors:     map[string]color.Attribute{},
 		workerTime: map[string]time.Time{},
 	}
@@ -61,6 +88,7 @@ func (u *UI) Reset() {
 	u.pending = map[string]string{}
 	u.dedupe = map[string]bool{}
 	u.timing = map[string]time.Time{}
+	u.results = map[string]reportResult{}
 }
 
 func (u *UI) Trigger(evt *project.StackEvent) {
@@ -68,6 +96,7 @@ func (u *UI) Trigger(evt *project.StackEvent) {
 		u.printEvent(color.FgRed, "Locked", "A concurrent update was detected on the stack. Run `sst unlock` to delete the lock file and retry.")
 	}
 	if evt.StackCommandEvent != nil {
+		u.started = time.Now()
 		u.spinner.Disable()
 
 		if evt.StackCommandEvent.Command == "up" {
@@ -98,6 +127,29 @@ func (u *UI) Trigger(evt *project.StackEvent) {
 		u.spinner.Suffix = "  Finalizing..."
 	}
 
+	if evt.PreludeEvent != nil && u.retrying {
+		// the summary only covers the last attempt
+		u.retrying = false
+		u.results = map[string]reportResult{}
+	}
+
+	if evt.RetryEvent != nil {
+		u.retrying = true
+		message := fmt.Sprintf("attempt %d of %d in %s", evt.RetryEvent.Attempt, evt.RetryEvent.Max, evt.RetryEvent.Delay)
+		if len(evt.RetryEvent.Errors) > 0 {
+			if lines := parseError(evt.RetryEvent.Errors[0].Message); len(lines) > 0 {
+				message += ", " + lines[0]
+			}
+		}
+		u.printEvent(color.FgYellow, "Retrying", message)
+		return
+	}
+
+	if evt.HookEvent != nil {
+		u.printEvent(color.FgBlue, "Hook", evt.HookEvent.Name+" "+evt.HookEvent.Command)
+		return
+	}
+
 	if evt.StdOutEvent != nil {
 		u.spinner.Disable()
 		fmt.Println(evt.StdOutEvent.Text)
@@ -213,6 +265,10 @@ func (u *UI) Trigger(evt *project.StackEvent) {
 		}
 
 		duration := time.Since(u.timing[evt.ResOutputsEvent.Metadata.URN]).Round(time.Millisecond)
+		u.results[evt.ResOutputsEvent.Metadata.URN] = reportResult{
+			op:       evt.ResOutputsEvent.Metadata.Op,
+			duration: duration,
+		}
 		if evt.ResOutputsEvent.Metadata.Op == apitype.OpSame && u.mode == ProgressModeRefresh {
 			u.printProgress(Progress{
 				Color:    color.FgGreen,
@@ -312,6 +368,7 @@ func (u *UI) Trigger(evt *project.StackEvent) {
 
 	if evt.CompleteEvent != nil {
 		u.complete = evt.CompleteEvent
+		u.finished = time.Now()
 		u.spinner.Disable()
 		defer fmt.Println()
 		if u.hasProgress {
@@ -337,6 +394,10 @@ func (u *UI) Trigger(evt *project.StackEvent) {
 					color.New(color.FgWhite, color.Bold).Println("  Refreshed")
 				}
 			}
+			if len(evt.CompleteEvent.Retained) > 0 {
+				color.New(color.FgHiBlack).Println("   These resources were retained and still exist in your account:")
+				u.printResources(evt.CompleteEvent.Retained)
+			}
 			if len(evt.CompleteEvent.Hints) > 0 {
 				for k, v := range evt.CompleteEvent.Hints {
 					splits := strings.Split(k, "::")
@@ -355,6 +416,9 @@ func (u *UI) Trigger(evt *project.StackEvent) {
 					color.New(color.FgWhite).Println(v)
 				}
 			}
+			if u.hasProgress && u.mode != ProgressModeDev {
+				u.printSummary()
+			}
 			if u.footer != "" {
 				fmt.Println()
 				fmt.Println(u.footer)
@@ -455,12 +519,81 @@ func (u *UI) printEvent(barColor color.Attribute, label string, message string)
 		u.spinner.Disable()
 		defer u.spinner.Enable()
 	}
-	color.New(barColor, color.Bold).Print("|  ")
+	u.printBar(barColor)
 	color.New(color.FgHiBlack).Print(fmt.Sprintf("%-11s", label), " ", strings.TrimSpace(message))
 	fmt.Println()
 	u.hasProgress = true
 }
 
+// PrintRemovePlan lists what a remove will delete and what it will retain,
+// without removing anything.
+func (u *UI) PrintRemovePlan(removed []apitype.ResourceV3, retained []apitype.ResourceV3) {
+	if len(removed) == 0 && len(retained) == 0 {
+		color.New(color.FgGreen, color.Bold).Print(IconCheck)
+		color.New(color.FgWhite, color.Bold).Println("  Stage already removed")
+		return
+	}
+	if len(removed) > 0 {
+		color.New(color.FgRed, color.Bold).Print("~")
+		color.New(color.FgWhite, color.Bold).Printf("  Will remove %d resources\n", len(removed))
+		u.printResources(removed)
+		fmt.Println()
+	}
+	if len(retained) > 0 {
+		color.New(color.FgYellow, color.Bold).Print("~")
+		color.New(color.FgWhite, color.Bold).Printf("  Will retain %d resources\n", len(retained))
+		u.printResources(retained)
+		fmt.Println()
+	}
+}
+
+func (u *UI) printResources(resources []apitype.ResourceV3) {
+	for _, item := range resources {
+		color.New(color.FgHiBlack).Print("   ")
+		color.New(color.FgHiBlack, color.Bold).Print(item.URN.Name() + " ")
+		color.New(color.FgHiBlack).Print(string(item.Type) + " ")
+		color.New(color.FgWhite).Println(string(item.ID))
+	}
+}
+
+// Confirm lists the protected resources that will be replaced or deleted and
+// asks the user to continue. It returns false without prompting if the
+// session is not interactive.
+func (u *UI) Confirm(changes []project.DestructiveChange) bool {
+	u.spinner.Disable()
+	defer u.spinner.Enable()
+	color.New(color.FgYellow, color.Bold).Print("!")
+	color.New(color.FgWhite, color.Bold).Println("  This deploy will replace or delete these protected resources")
+	for _, change := range changes {
+		label := "Delete"
+		if change.Op == apitype.OpReplace || change.Op == apitype.OpCreateReplacement {
+			label = "Replace"
+		}
+		color.New(color.FgYellow, color.Bold).Print("|  ")
+		color.New(color.FgHiBlack).Println(fmt.Sprintf("%-11s", label), u.formatURN(change.URN))
+	}
+	fmt.Println()
+	if !IsInteractive() {
+		return false
+	}
+	return Ask("Continue")
+}
+
+// Ask prompts the user with a yes or no question.
+func Ask(label string) bool {
+	p := promptui.Select{
+		Label:        "‏‏‎ ‎" + label,
+		HideSelected: true,
+		Items:        []string{"Yes", "No"},
+		HideHelp:     true,
+	}
+	_, answer, err := p.Run()
+	if err != nil {
+		return false
+	}
+	return answer == "Yes"
+}
+
 func (u *UI) Interrupt() {
 	u.spinner.Suffix = "  Interrupting..."
 }
@@ -563,9 +696,9 @@ func (u *UI) printProgress(progress Progress) {
 		return
 	}
 
-	color.New(progress.Color, color.Bold).Print("|  ")
+	u.printBar(progress.Color)
 	color.New(color.FgHiBlack).Print(fmt.Sprintf("%-11s", progress.Label), " ", u.formatURN(progress.URN))
-	if progress.Duration > time.Second {
+	if progress.Duration > time.Second || (u.plain && progress.Final && progress.Duration > 0) {
 		color.New(color.FgHiBlack).Printf(" (%.1fs)", progress.Duration.Seconds())
 	}
 	if len(progress.Message) == 1 {
@@ -574,7 +707,7 @@ func (u *UI) printProgress(progress Progress) {
 	if len(progress.Message) > 1 {
 		for _, item := range progress.Message {
 			fmt.Println()
-			color.New(progress.Color, color.Bold).Print("|  ")
+			u.printBar(progress.Color)
 			color.New(color.FgWhite).Print(item)
 		}
 	}
@@ -582,6 +715,19 @@ func (u *UI) printProgress(progress Progress) {
 	u.hasProgress = true
 }
 
+// bar returns the prefix of a progress line. In plain mode this is a
+// timestamp so CI logs can be read without the spinner.
+func bar(plain bool, barColor color.Attribute) string {
+	if plain {
+		return color.New(barColor).Sprint(time.Now().Format(time.RFC3339) + "  ")
+	}
+	return color.New(barColor, color.Bold).Sprint("|  ")
+}
+
+func (u *UI) printBar(barColor color.Attribute) {
+	fmt.Print(bar(u.plain, barColor))
+}
+
 func Success(msg string) {
 	color.New(color.FgGreen, color.Bold).Print(IconCheck + "  ")
 	color.New(color.FgWhite).Println(msg)
@@ -591,3 +737,8 @@ func Error(msg string) {
 	color.New(color.FgRed, color.Bold).Print(IconX + "  ")
 	color.New(color.FgWhite).Println(msg)
 }
+
+func Warn(msg string) {
+	color.New(color.FgYellow, color.Bold).Print("!  ")
+	color.New(color.FgWhite).Println(msg)
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 func FindUp(initialPath, fileName string) (string, error) {
@@ -34,3 +35,26 @@ func Exists(path string) bool {
 	}
 	return err == nil
 }
+
+// FindDown returns every file with the given name under the directory,
+// skipping dependencies and hidden directories.
+func FindDown(dir, fileName string) ([]string, error) {
+	result := []string{}
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			name := d.Name()
+			if path != dir && (name == "node_modules" || strings.HasPrefix(name, ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Name() == fileName {
+			result = append(result, path)
+		}
+		return nil
+	})
+	return result, err
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log/slog"
 	"path/filepath"
+	"sync/atomic"
 	"time"
 
 	esbuild "github.com/evanw/esbuild/pkg/api"
@@ -18,10 +19,14 @@ type EvalOptions struct {
 	Define map[string]string
 }
 
+// builds makes the output file unique when several builds start in the same
+// millisecond, like when deploying stages in parallel
+var builds atomic.Int64
+
 func Build(input EvalOptions) (esbuild.BuildResult, error) {
 	outfile := filepath.Join(input.Dir,
 		"eval",
-		fmt.Sprintf("eval-%v.mjs", time.Now().UnixMilli()),
+		fmt.Sprintf("eval-%v-%v.mjs", time.Now().UnixMilli(), builds.Add(1)),
 	)
 	slog.Info("esbuild building")
 	result := esbuild.Build(esbuild.BuildOptions{
@@ -0,0 +1,282 @@
+import http from "node:http";
+import url from "node:url";
+import util from "node:util";
+import { Readable } from "node:stream";
+import { AsyncLocalStorage } from "node:async_hooks";
+
+// Runs a module worker locally for `sst dev`. The bindings of the deployed
+// worker are passed in through SST_WORKER_BINDINGS, and KV, R2 and D1
+// bindings are proxied to the deployed resources with the Cloudflare API.
+// Service and queue bindings cannot be proxied, they throw when used.
+
+const file = process.argv[2];
+const [host, port] = process.argv[3].split(":");
+
+interface Bindings {
+  vars: Record<string, string>;
+  kv: { name: string; namespaceId: string }[];
+  r2: { name: string; bucketName: string }[];
+  d1: { name: string; databaseId: string }[];
+  secrets: Record<string, string>;
+  service: { name: string }[];
+  queue: { name: string }[];
+}
+
+const bindings: Bindings = JSON.parse(process.env.SST_WORKER_BINDINGS || "{}");
+const ACCOUNT_ID = process.env.CLOUDFLARE_DEFAULT_ACCOUNT_ID!;
+const API = `https://api.cloudflare.com/client/v4/accounts/${ACCOUNT_ID}`;
+
+function authHeaders(): Record<string, string> {
+  if (process.env.CLOUDFLARE_API_TOKEN)
+    return { Authorization: `Bearer ${process.env.CLOUDFLARE_API_TOKEN}` };
+  return {
+    "X-Auth-Key": process.env.CLOUDFLARE_API_KEY!,
+    "X-Auth-Email": process.env.CLOUDFLARE_EMAIL!,
+  };
+}
+
+async function api(path: string, init: RequestInit = {}) {
+  const response = await fetch(API + path, {
+    ...init,
+    headers: { ...authHeaders(), ...(init.headers as any) },
+  });
+  if (response.status === 404) return;
+  if (!response.ok)
+    throw new Error(
+      `Cloudflare API ${init.method || "GET"} ${path} failed with ${
+        response.status
+      }: ${await response.text()}`,
+    );
+  return response;
+}
+
+async function read(response: Response, type?: string) {
+  if (type === "json") return response.json();
+  if (type === "arrayBuffer") return response.arrayBuffer();
+  if (type === "stream") return response.body;
+  return response.text();
+}
+
+function kv(namespaceId: string) {
+  const base = `/storage/kv/namespaces/${namespaceId}`;
+  return {
+    async get(key: string, options?: string | { type?: string }) {
+      const response = await api(`${base}/values/${encodeURIComponent(key)}`);
+      if (!response) return null;
+      return read(
+        response,
+        typeof options === "string" ? options : options?.type,
+      );
+    },
+    async put(key: string, value: any, options?: { expirationTtl?: number }) {
+      const query = options?.expirationTtl
+        ? `?expiration_ttl=${options.expirationTtl}`
+        : "";
+      await api(`${base}/values/${encodeURIComponent(key)}${query}`, {
+        method: "PUT",
+        body: value,
+      });
+    },
+    async delete(key: string) {
+      await api(`${base}/values/${encodeURIComponent(key)}`, {
+        method: "DELETE",
+      });
+    },
+    async list(options?: { prefix?: string; limit?: number; cursor?: string }) {
+      const query = new URLSearchParams();
+      if (options?.prefix) query.set("prefix", options.prefix);
+      if (options?.limit) query.set("limit", String(options.limit));
+      if (options?.cursor) query.set("cursor", options.cursor);
+      const response = await api(`${base}/keys?${query}`);
+      const body: any = await response!.json();
+      return {
+        keys: body.result,
+        list_complete: !body.result_info?.cursor,
+        cursor: body.result_info?.cursor,
+      };
+    },
+  };
+}
+
+function r2(bucketName: string) {
+  const base = `/r2/buckets/${bucketName}/objects`;
+  const path = (key: string) =>
+    `${base}/${key.split("/").map(encodeURIComponent).join("/")}`;
+  return {
+    async get(key: string) {
+      const response = await api(path(key));
+      if (!response) return null;
+      return {
+        key,
+        size: Number(response.headers.get("content-length") || 0),
+        httpEtag: response.headers.get("etag"),
+        body: response.body,
+        text: () => response.text(),
+        json: () => response.json(),
+        arrayBuffer: () => response.arrayBuffer(),
+      };
+    },
+    async put(key: string, value: any) {
+      await api(path(key), { method: "PUT", body: value });
+      return { key };
+    },
+    async delete(key: string | string[]) {
+      for (const item of Array.isArray(key) ? key : [key]) {
+        await api(path(item), { method: "DELETE" });
+      }
+    },
+  };
+}
+
+function d1(databaseId: string) {
+  async function query(sql: string, params: any[]) {
+    const response = await api(`/d1/database/${databaseId}/query`, {
+      method: "POST",
+      headers: { "content-type": "application/json" },
+      body: JSON.stringify({ sql, params }),
+    });
+    const body: any = await response!.json();
+    return body.result as { results: any[]; success: boolean; meta: any }[];
+  }
+  function statement(sql: string, params: any[] = []) {
+    return {
+      sql,
+      params,
+      bind: (...values: any[]) => statement(sql, values),
+      async all() {
+        return (await query(sql, params))[0];
+      },
+      async run() {
+        return (await query(sql, params))[0];
+      },
+      async first(column?: string) {
+        const [result] = await query(sql, params);
+        const row = result.results[0];
+        if (!row) return null;
+        return column ? row[column] : row;
+      },
+      async raw() {
+        const [result] = await query(sql, params);
+        return result.results.map((row) => Object.values(row));
+      },
+    };
+  }
+  return {
+    prepare: (sql: string) => statement(sql),
+    async batch(statements: ReturnType<typeof statement>[]) {
+      const results = [];
+      for (const item of statements) {
+        results.push((await query(item.sql, item.params))[0]);
+      }
+      return results;
+    },
+    async exec(sql: string) {
+      const results = await query(sql, []);
+      return {
+        count: results.length,
+        duration: results.reduce(
+          (sum, item) => sum + (item.meta?.duration ?? 0),
+          0,
+        ),
+      };
+    },
+  };
+}
+
+function unsupported(kind: string, name: string) {
+  console.warn(
+    `The ${kind} binding "${name}" is not available in sst dev, it throws when used`,
+  );
+  return new Proxy(
+    {},
+    {
+      get(_, prop) {
+        // so the binding is not mistaken for a promise
+        if (prop === "then") return undefined;
+        return () => {
+          throw new Error(
+            `The ${kind} binding "${name}" is not available in sst dev`,
+          );
+        };
+      },
+    },
+  );
+}
+
+const env: Record<string, any> = { ...bindings.vars, ...bindings.secrets };
+for (const item of bindings.kv || []) env[item.name] = kv(item.namespaceId);
+for (const item of bindings.r2 || []) env[item.name] = r2(item.bucketName);
+for (const item of bindings.d1 || []) env[item.name] = d1(item.databaseId);
+for (const item of bindings.service || [])
+  env[item.name] = unsupported("service", item.name);
+for (const item of bindings.queue || [])
+  env[item.name] = unsupported("queue", item.name);
+
+// the lines logged while handling a request are marked with its ID, so the
+// CLI can show them under the right request when several run at once
+const REQUEST_HEADER = "x-sst-request-id";
+const LOG_MARKER = "\x1f";
+const requests = new AsyncLocalStorage<string>();
+for (const level of ["log", "info", "warn", "error", "debug"] as const) {
+  const original = console[level].bind(console);
+  console[level] = (...args: any[]) => {
+    const requestID = requests.getStore();
+    if (!requestID) return original(...args);
+    original(
+      util
+        .format(...args)
+        .split("\n")
+        .map((line) => LOG_MARKER + requestID + LOG_MARKER + line)
+        .join("\n"),
+    );
+  };
+}
+
+const mod = await import(url.pathToFileURL(file).href);
+const worker = mod.default;
+if (!worker?.fetch) {
+  console.error(`The worker in "${file}" does not export a default fetch`);
+  process.exit(1);
+}
+
+http
+  .createServer(async (req, res) => {
+    const requestID = req.headers[REQUEST_HEADER] as string | undefined;
+    delete req.headers[REQUEST_HEADER];
+    if (!requestID) return handle(req, res);
+    return requests.run(requestID, () => handle(req, res));
+  })
+  .listen(Number(port), host);
+
+async function handle(req: http.IncomingMessage, res: http.ServerResponse) {
+  const pending: Promise<any>[] = [];
+  try {
+    const request = new Request(`http://${req.headers.host}${req.url}`, {
+      method: req.method,
+      headers: req.headers as Record<string, string>,
+      body:
+        req.method === "GET" || req.method === "HEAD"
+          ? undefined
+          : (Readable.toWeb(req) as any),
+      // @ts-expect-error needed by node to send a stream body
+      duplex: "half",
+    });
+    const response: Response = await worker.fetch(request, env, {
+      waitUntil: (promise: Promise<any>) => pending.push(promise),
+      passThroughOnException: () => {},
+    });
+    res.writeHead(
+      response.status,
+      Object.fromEntries(response.headers as any),
+    );
+    if (response.body) {
+      for await (const chunk of response.body as any) res.write(chunk);
+    }
+    res.end();
+  } catch (ex: any) {
+    console.error(ex);
+    res.writeHead(500, { "content-type": "text/plain" });
+    res.end(ex?.stack || String(ex));
+  }
+  await Promise.allSettled(pending);
+}
@@ -18,6 +18,7 @@ export async function run(program: automation.PulumiFn) {
   addTransformationToRetainResourcesOnDelete();
   addTransformationToEnsureUniqueComponentNames();
   addTransformationToCheckBucketsHaveMultiplePolicies();
+  addTransformationToSetPermissionsBoundary();
 
   Link.makeLinkable(aws.dynamodb.Table, function () {
     return {
@@ -105,3 +106,16 @@ function addTransformationToCheckBucketsHaveMultiplePolicies() {
     return undefined;
   });
 }
+
+function addTransformationToSetPermissionsBoundary() {
+  const boundary = process.env.SST_AWS_PERMISSIONS_BOUNDARY;
+  if (!boundary) return;
+  runtime.registerStackTransformation((args: ResourceTransformationArgs) => {
+    if (args.type !== "aws:iam/role:Role") return;
+    if (args.props.permissionsBoundary) return;
+    return {
+      props: { ...args.props, permissionsBoundary: boundary },
+      opts: args.opts,
+    };
+  });
+}
@@ -13,6 +13,7 @@ import { build } from "../../runtime/cloudflare.js";
 import { Component, Prettify, Transform, transform } from "../component";
 import { WorkersUrl } from "./providers/workers-url.js";
 import { Link } from "../link.js";
+import { Warp } from "../warp.js";
 import type { Input } from "../input.js";
 
 /**
@@ -154,6 +155,25 @@ export interface WorkerArgs {
    * ```
    */
   environment?: Input<Record<string, Input<string>>>;
+  /**
+   * Run the worker locally in `sst dev`. The deployed worker is left as is, and
+   * the local one is served on `localhost`, starting at port `8787`.
+   *
+   * Its KV namespace, R2 bucket and D1 database bindings are proxied to the
+   * deployed ones through the Cloudflare API, and secret text bindings are
+   * passed in as is. Service and queue bindings are not available locally,
+   * they throw when used.
+   *
+   * @default `true`
+   *
+   * @example
+   * ```js
+   * {
+   *   live: false
+   * }
+   * ```
+   */
+  live?: Input<boolean>;
   /**
    * [Transform](/docs/components#transform/) how this component creates its underlying
    * resources.
@@ -243,6 +263,7 @@ export class Worker extends Component {
     const script = createScript();
     const workersUrl = createWorkersUrl();
     createWorkersDomain();
+    registerWarp();
 
     this.script = script;
     this.workersUrl = workersUrl;
@@ -352,6 +373,83 @@ export class Worker extends Component {
       );
     }
 
+    function registerWarp() {
+      const dev = output(args.live).apply((v) => $dev && v !== false);
+      const links = output(linkData).apply((input) =>
+        input.map((item) => item.name),
+      );
+      Warp.register(
+        name,
+        all([
+          dev,
+          links,
+          args.handler,
+          args.build,
+          args.environment,
+          script.kvNamespaceBindings,
+          script.r2BucketBindings,
+          script.d1DatabaseBindings,
+          script.secretTextBindings,
+          script.serviceBindings,
+          script.queueBindings,
+        ]).apply(
+          ([
+            dev,
+            links,
+            handler,
+            build,
+            environment,
+            kv,
+            r2,
+            d1,
+            secrets,
+            services,
+            queues,
+          ]) => {
+            if (!dev) return undefined;
+            return {
+              functionID: name,
+              links,
+              handler,
+              runtime: "worker",
+              properties: {
+                build: {
+                  loader: build?.loader,
+                  banner: build?.banner,
+                  minify: build?.minify,
+                },
+                environment: environment ?? {},
+                kv: (kv ?? []).map((item) => ({
+                  name: item.name,
+                  namespaceId: item.namespaceId,
+                })),
+                r2: (r2 ?? []).map((item) => ({
+                  name: item.name,
+                  bucketName: item.bucketName,
+                })),
+                d1: (d1 ?? []).map((item) => ({
+                  name: item.name,
+                  databaseId: item.databaseId,
+                })),
+                // the AWS credentials of the CLI are used locally instead
+                secrets: Object.fromEntries(
+                  (secrets ?? [])
+                    .filter((item) => item.name !== "AWS_SECRET_ACCESS_KEY")
+                    .map((item) => [item.name, item.text]),
+                ),
+                service: (services ?? []).map((item) => ({
+                  name: item.name,
+                })),
+                queue: (queues ?? []).map((item) => ({
+                  name: item.binding,
+                })),
+              },
+            };
+          },
+        ),
+      );
+    }
+
     function createWorkersUrl() {
       return new WorkersUrl(
         `${name}Url`,
@@ -130,6 +130,67 @@ export interface App {
    * }
    * ```
    *
+   * Nested props, like `assumeRole` or `defaultTags` for AWS, are passed to the provider as is. Wrap a value in `$secret` to keep it encrypted in the state. Props like `accessKey`, `secretKey`, and `token` are always kept encrypted.
+   *
+   * ```ts
+   * {
+   *   providers: {
+   *     aws: {
+   *       assumeRole: {
+   *         roleArn: $secret("arn:aws:iam::123456789012:role/deploy"),
+   *         sessionName: "sst"
+   *       },
+   *       defaultTags: {
+   *         tags: { team: "web" }
+   *       }
+   *     }
+   *   }
+   * }
+   * ```
+   *
+   * For AWS, the `assumeRole` is used by SST to store the state as well, so the state lives in the account of the role. Pass a list of roles to assume them in order, each one with the credentials of the previous one. Each role takes a `roleArn`, and an optional `externalId`, `sessionName`, and `duration`, like `"1h"`. SST assumes the roles once and passes the temporary credentials to the deploy, so they are not refreshed while it runs. For deploys that take longer than the default of 15 minutes, set a longer `duration`, up to the maximum session duration of the role.
+   *
+   * ```ts
+   * {
+   *   providers: {
+   *     aws: {
+   *       assumeRole: [
+   *         { roleArn: "arn:aws:iam::111111111111:role/hub" },
+   *         { roleArn: "arn:aws:iam::222222222222:role/deploy", externalId: "sst" }
+   *       ]
+   *     }
+   *   }
+   * }
+   * ```
+   *
+   * The `home` provider also takes a `bootstrap` arg, to customize the resources SST creates to store your state. For AWS, you can set the `assetBucket` and `stateBucket` names, turn off `versioning`, encrypt the state with a `kmsKey`, send access logs to a `logBucket`, add `tags`, and set a `permissionsBoundary` policy ARN that's applied to the IAM roles your apps create. For Cloudflare, you can set the `stateBucket` name, it defaults to `sst-state`. These are only used when the bootstrap is created, run `sst bootstrap` to review it first. If the bootstrap was created by an older version of SST, run `sst bootstrap` to migrate it.
+   *
+   * ```ts
+   * {
+   *   providers: {
+   *     aws: {
+   *       bootstrap: {
+   *         stateBucket: "acme-sst-state",
+   *         kmsKey: "alias/sst",
+   *         tags: { team: "platform" }
+   *       }
+   *     }
+   *   }
+   * }
+   * ```
+   *
+   * For Cloudflare, set the `accountId` if your credentials have access to more than one account. It's used for both your resources and your state. If it's not set, SST falls back to the `CLOUDFLARE_DEFAULT_ACCOUNT_ID` environment variable, and then to the only account the credentials have access to.
+   *
+   * ```ts
+   * {
+   *   providers: {
+   *     cloudflare: {
+   *       accountId: "6fef9ed9089bb15de3e4198618385de2"
+   *     }
+   *   }
+   * }
+   * ```
+   *
    * You also add multiple providers.
    *
    * ```ts
@@ -176,8 +237,253 @@ export interface App {
    * }
    * ```
    *
+   * To store the state somewhere else, use a home plugin with `plugin:<name>`. This runs the `sst-home-<name>` executable from your `node_modules/.bin` or your `PATH`. Its args are set in `plugins`.
+   *
+   * ```ts
+   * {
+   *   home: "plugin:gcs",
+   *   plugins: {
+   *     gcs: {
+   *       bucket: "my-state"
+   *     }
+   *   }
+   * }
+   * ```
+   *
+   * The plugin talks to the CLI with JSON-RPC 2.0 over stdio, one message per line. It implements `initialize`, `getData`, `putData`, `removeData`, `listData`, `getPassphrase`, and `setPassphrase`. Data is base64 encoded, `getData` returns `null` for missing data, and `listData` returns the `stages` of an app that have data for a key. Each request has to be answered within 5 minutes, and the plugin should exit when its stdin is closed, or it's killed.
+   *
+   */
+  home: "aws" | "cloudflare" | `plugin:${string}`;
+
+  /**
+   * The args of the home plugins, by the name of the plugin. These are passed to the plugin when it is initialized.
+   *
+   * @example
+   * ```ts
+   * {
+   *   plugins: {
+   *     gcs: {
+   *       bucket: "my-state"
+   *     }
+   *   }
+   * }
+   * ```
+   */
+  plugins?: Record<string, Record<string, any>>;
+
+  /**
+   * The resource types that need to be confirmed before they are replaced or deleted on `sst deploy`. A type ending in `*` matches all the types that start with it.
+   *
+   * If the stage has resources of these types, the CLI previews the changes before deploying. If any of them will be replaced or deleted, it lists them and asks you to confirm. In a non-interactive session, you need to pass in `--yes`.
+   *
+   * Set it to an empty list to skip the check.
+   *
+   * @default S3 buckets, DynamoDB tables, RDS resources, EFS file systems, R2 buckets, D1 databases, and KV namespaces.
+   *
+   * @example
+   *
+   * ```ts
+   * {
+   *   protected: ["aws:rds/*", "aws:s3/bucketV2:BucketV2"]
+   * }
+   * ```
+   */
+  protected?: string[];
+
+  /**
+   * Protect a stage from commands that can destroy it. On a protected stage, `sst remove`, `sst unlock`, `sst state edit`, and importing resources refuse to run unless you pass in `--i-know` and type in the name of the stage.
+   *
+   * Takes a boolean or a list of stage names.
+   *
+   * @default `false`
+   * @example
+   * Protect the _production_ stage.
+   * ```ts
+   * {
+   *   protect: input.stage === "production"
+   * }
+   * ```
+   *
+   * Or pass in a list of stages.
+   *
+   * ```ts
+   * {
+   *   protect: ["production", "staging"]
+   * }
+   * ```
+   */
+  protect?: boolean | string[];
+
+  /**
+   * Only deploy some stages from a clean git working tree. `sst deploy` fails on these stages if there are uncommitted changes, or if the commit is not on one of the allowed branches.
+   *
+   * @example
+   * Only deploy _production_ from commits on `main`.
+   * ```ts
+   * {
+   *   git: {
+   *     stages: ["production"],
+   *     branches: ["main"]
+   *   }
+   * }
+   * ```
+   */
+  git?: {
+    /**
+     * The stages that need a clean working tree.
+     */
+    stages: string[];
+    /**
+     * The branches the deployed commit has to be on. If not set, any commit is allowed.
+     */
+    branches?: string[];
+  };
+
+  /**
+   * Shell commands to run before and after `sst deploy` and `sst remove`. They run in the root of your app, with the secrets of the stage in the environment.
+   *
+   * The post hooks also get the linked resources as `SST_RESOURCE_<name>` and the outputs of the app as `SST_OUTPUT_<name>`, like `sst shell`.
+   *
+   * If a hook exits with a non-zero code, the command fails. A failing pre hook stops the deploy or remove from running.
+   *
+   * @example
+   * Run migrations before deploying and smoke tests after.
+   * ```ts
+   * {
+   *   hooks: {
+   *     preDeploy: "npm run migrate",
+   *     postDeploy: "npm run test:smoke"
+   *   }
+   * }
+   * ```
+   */
+  hooks?: {
+    /**
+     * Runs before `sst deploy`.
+     */
+    preDeploy?: string;
+    /**
+     * Runs after a successful `sst deploy`.
+     */
+    postDeploy?: string;
+    /**
+     * Runs before `sst remove`.
+     */
+    preRemove?: string;
+    /**
+     * Runs after a successful `sst remove`.
+     */
+    postRemove?: string;
+  };
+
+  /**
+   * Get notified when a stage is deployed, removed, or refreshed. The CLI sends a `POST` request with a JSON payload to each webhook, with the `event`, `app`, `stage`, `command`, `user`, `git` commit, `duration`, `outputs`, and `errors`.
+   *
+   * Failed requests are retried a few times. A failed notification does not fail the command.
+   *
+   * @example
+   * Notify a webhook when the _production_ stage fails to deploy.
+   * ```ts
+   * {
+   *   notifications: input.stage === "production" ? {
+   *     webhooks: [
+   *       {
+   *         url: "https://example.com/hooks/deploy",
+   *         events: ["failed"],
+   *         secret: process.env.WEBHOOK_SECRET
+   *       }
+   *     ]
+   *   } : undefined
+   * }
+   * ```
+   */
+  notifications?: {
+    webhooks: {
+      /**
+       * The URL to `POST` to.
+       */
+      url: string;
+      /**
+       * The events to send. Defaults to all of them.
+       */
+      events?: ("started" | "succeeded" | "failed")[];
+      /**
+       * If set, the payload is signed with HMAC-SHA256 and sent in the `X-SST-Signature` header as `sha256=<hex>`.
+       */
+      secret?: string;
+    }[];
+  };
+
+  /**
+   * Retry `sst deploy` when it fails with transient errors, like throttling or IAM roles that have not propagated yet. The deploy is only retried if all the errors match one of the patterns, with a backoff that doubles after every attempt.
+   *
+   * @example
+   * Retry up to 5 times, including on a custom error.
+   * ```ts
+   * {
+   *   retry: {
+   *     attempts: 5,
+   *     patterns: ["ServiceUnavailable"]
+   *   }
+   * }
+   * ```
+   */
+  retry?: {
+    /**
+     * The max number of times to run the deploy, including the first one. Set to `1` to disable retries.
+     * @default `3`
+     */
+    attempts?: number;
+    /**
+     * Regular expressions for errors that are safe to retry. These are added to the built-in ones for throttling and eventual consistency errors.
+     */
+    patterns?: string[];
+  };
+
+  /**
+   * Override the config for the stages that match a pattern, like deploying `production` to a different AWS account and region. The pattern can use `*` to match any characters.
+   *
+   * The provider args of an override are applied on top of the `providers`, one arg at a time. If several patterns match a stage, the ones with a `*` are applied first, shorter patterns before longer ones, and an exact match is applied last.
+   *
+   * @example
+   * Use a separate profile for preview stages, and deploy `production` to its own account by assuming a role in it.
+   * ```ts
+   * {
+   *   providers: {
+   *     aws: {
+   *       profile: "dev"
+   *     }
+   *   },
+   *   stages: {
+   *     "pr-*": {
+   *       providers: {
+   *         aws: { profile: "preview" }
+   *       }
+   *     },
+   *     production: {
+   *       providers: {
+   *         aws: {
+   *           region: "eu-west-1",
+   *           assumeRole: {
+   *             roleArn: "arn:aws:iam::123456789012:role/deploy",
+   *             externalId: "sst"
+   *           }
+   *         }
+   *       }
+   *     }
+   *   }
+   * }
+   * ```
    */
-  home: "aws" | "cloudflare";
+  stages?: Record<
+    string,
+    {
+      /**
+       * The provider args to use for the stage. Each provider takes an object of args.
+       */
+      providers?: Record<string, Record<string, any>>;
+    }
+  >;
 }
 
 export interface AppInput {
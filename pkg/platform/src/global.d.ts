@@ -202,6 +202,30 @@ declare global {
    */
   export const $dev: boolean;
 
+  /**
+   * Get the linked resources of another app, or another stage of this app. These are the same values that `sst shell` gets for that stage.
+   *
+   * The referenced stage needs to be deployed first, otherwise the deploy fails. References are resolved before your app is run, so the app and stage need to be string literals, or `$app.stage`. It can be used in your `sst.config.ts` or any file it imports.
+   *
+   * @param app The name of the app.
+   * @param stage The stage of the app. Defaults to the current stage.
+   *
+   * @example
+   * Use the bucket of the _api_ app in the _production_ stage.
+   *
+   * ```ts title="sst.config.ts"
+   * const api = $ref("api", "production");
+   *
+   * new sst.aws.Function("MyFunction", {
+   *   handler: "src/lambda.handler",
+   *   environment: {
+   *     BUCKET: api.MyBucket.name
+   *   }
+   * });
+   * ```
+   */
+  export function $ref(app: string, stage?: string): Record<string, any>;
+
   /** @internal */
   export const $cli: {
     command: string;
@@ -212,5 +236,13 @@ declare global {
       platform: string;
     };
     home: string;
+    /**
+     * The git commit the app is deployed from, if the project root is a git repo.
+     */
+    git?: {
+      commit: string;
+      branch: string;
+      dirty: boolean;
+    };
   };
 }
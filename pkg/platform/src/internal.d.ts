@@ -8,6 +8,11 @@ declare global {
       platform: string;
     };
     home: string;
+    git?: {
+      commit: string;
+      branch: string;
+      dirty: boolean;
+    };
   };
 }
 
@@ -8,6 +8,15 @@ const { output, apply, all, interpolate, concat, jsonParse, jsonStringify } =
   util;
 
 const makeLinkable = Link.makeLinkable;
+
+function ref(app, stage = $app.stage) {
+  const links = $refs[`${app}/${stage}`];
+  if (!links)
+    throw new Error(
+      `Could not resolve $ref("${app}", "${stage}"). The app and stage need to be passed in as string literals, or $app.stage.`,
+    );
+  return links;
+}
 export {
   makeLinkable as "$linkable",
   output as "$output",
@@ -21,4 +30,5 @@ export {
   sst as "sst",
   $config as "$config",
   $secrets as "$secrets",
+  ref as "$ref",
 };
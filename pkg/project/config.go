@@ -0,0 +1,87 @@
+package project
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/auto"
+)
+
+// secretKey marks a value as secret in the provider config, it is set by
+// $secret in sst.config.ts.
+const secretKey = "__secret"
+
+// sensitiveKeys are always sent as secrets, even if they are not marked.
+var sensitiveKeys = map[string]bool{
+	"accessKey": true,
+	"secretKey": true,
+	"token":     true,
+	"apiToken":  true,
+	"apiKey":    true,
+}
+
+var simpleKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// providerConfig turns the provider args into pulumi config. Nested objects
+// and lists are flattened into paths, like aws:assumeRole.roleArn and
+// aws:allowedAccountIds[0], so they have to be set with the Path option.
+func providerConfig(providers map[string]interface{}) auto.ConfigMap {
+	config := auto.ConfigMap{}
+	for provider, args := range providers {
+		for key, value := range args.(map[string]interface{}) {
+			// version is the version of the package that is installed
+			if key == "version" {
+				continue
+			}
+			// the cloudflare provider has no accountId, it is passed to the
+			// program as CLOUDFLARE_DEFAULT_ACCOUNT_ID instead
+			if provider == "cloudflare" && key == "accountId" {
+				continue
+			}
+			flattenConfig(fmt.Sprintf("%v:%v", provider, key), value, sensitiveKeys[key], config)
+		}
+	}
+	return config
+}
+
+func flattenConfig(path string, value interface{}, secret bool, config auto.ConfigMap) {
+	switch v := value.(type) {
+	case nil:
+		return
+	case string:
+		config[path] = auto.ConfigValue{Value: v, Secret: secret}
+	case bool:
+		config[path] = auto.ConfigValue{Value: strconv.FormatBool(v), Secret: secret}
+	case float64:
+		config[path] = auto.ConfigValue{Value: strconv.FormatFloat(v, 'f', -1, 64), Secret: secret}
+	case []string:
+		for i, item := range v {
+			flattenConfig(fmt.Sprintf("%v[%d]", path, i), item, secret, config)
+		}
+	case []interface{}:
+		for i, item := range v {
+			flattenConfig(fmt.Sprintf("%v[%d]", path, i), item, secret, config)
+		}
+	case map[string]interface{}:
+		if inner, ok := v[secretKey]; ok && len(v) == 1 {
+			flattenConfig(path, inner, true, config)
+			return
+		}
+		for key, item := range v {
+			child := path + "." + key
+			if !simpleKey.MatchString(key) {
+				child = fmt.Sprintf("%v[%q]", path, key)
+			}
+			flattenConfig(child, item, secret || sensitiveKeys[key], config)
+		}
+	}
+}
+
+// setProviderConfig sets the provider config on the stack.
+func (s *stack) setProviderConfig(ctx context.Context, stack auto.Stack) error {
+	return stack.SetAllConfigWithOptions(ctx, providerConfig(s.project.app.Providers), &auto.ConfigOptions{
+		Path: true,
+	})
+}
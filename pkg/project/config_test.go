@@ -0,0 +1,43 @@
+package project
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/auto"
+)
+
+func TestProviderConfig(t *testing.T) {
+	config := providerConfig(map[string]interface{}{
+		"aws": map[string]interface{}{
+			"version":                   "6.0.0",
+			"region":                    "us-east-1",
+			"maxRetries":                float64(5),
+			"skipCredentialsValidation": true,
+			"allowedAccountIds":         []interface{}{"123"},
+			"assumeRole": map[string]interface{}{
+				"roleArn":         "arn:aws:iam::123:role/deploy",
+				"durationSeconds": float64(900),
+			},
+			"defaultTags": map[string]interface{}{
+				"tags": map[string]interface{}{"team:name": "web"},
+			},
+			"secretKey": "abc",
+			"profile":   map[string]interface{}{secretKey: "prod"},
+		},
+	})
+	expected := auto.ConfigMap{
+		"aws:region":                        {Value: "us-east-1"},
+		"aws:maxRetries":                    {Value: "5"},
+		"aws:skipCredentialsValidation":     {Value: "true"},
+		"aws:allowedAccountIds[0]":          {Value: "123"},
+		"aws:assumeRole.roleArn":            {Value: "arn:aws:iam::123:role/deploy"},
+		"aws:assumeRole.durationSeconds":    {Value: "900"},
+		`aws:defaultTags.tags["team:name"]`: {Value: "web"},
+		"aws:secretKey":                     {Value: "abc", Secret: true},
+		"aws:profile":                       {Value: "prod", Secret: true},
+	}
+	if !reflect.DeepEqual(config, expected) {
+		t.Errorf("unexpected config %v", config)
+	}
+}
@@ -0,0 +1,82 @@
+package project
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/sst/ion/internal/util"
+)
+
+type GitInfo struct {
+	Commit string `json:"commit"`
+	Branch string `json:"branch"`
+	Dirty  bool   `json:"dirty"`
+}
+
+func git(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	output, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// gitInfo returns the commit the project root is checked out at, or nil if it
+// is not a git repo. If the working tree cannot be checked, it is reported as
+// dirty along with the error.
+func gitInfo(dir string) (*GitInfo, error) {
+	commit, err := git(dir, "rev-parse", "HEAD")
+	if err != nil {
+		return nil, nil
+	}
+	// this is empty for a detached HEAD, like in most CI environments
+	branch, _ := git(dir, "symbolic-ref", "--short", "-q", "HEAD")
+	status, err := git(dir, "status", "--porcelain")
+	return &GitInfo{
+		Commit: commit,
+		Branch: branch,
+		Dirty:  err != nil || status != "",
+	}, err
+}
+
+// gitOnBranch checks if the commit is on the local or remote branch.
+func gitOnBranch(dir string, commit string, branch string) bool {
+	for _, ref := range []string{branch, "origin/" + branch} {
+		_, err := git(dir, "merge-base", "--is-ancestor", commit, ref)
+		if err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// checkGit refuses to deploy a stage listed in the git config if the working
+// tree is dirty or the commit is not on one of the allowed branches. The
+// statusErr is the error from checking the working tree with gitInfo.
+func (p *Project) checkGit(info *GitInfo, statusErr error) error {
+	cfg := p.app.Git
+	if cfg == nil || !cfg.HasStage(p.app.Stage) {
+		return nil
+	}
+	if statusErr != nil {
+		return util.NewReadableError(statusErr, fmt.Sprintf("Could not check for uncommitted changes before deploying the stage \"%s\": %s", p.app.Stage, statusErr))
+	}
+	if info == nil {
+		return util.NewReadableError(nil, fmt.Sprintf("The stage \"%s\" can only be deployed from a git repo", p.app.Stage))
+	}
+	if info.Dirty {
+		return util.NewReadableError(nil, fmt.Sprintf("The stage \"%s\" cannot be deployed with uncommitted changes", p.app.Stage))
+	}
+	if len(cfg.Branches) == 0 {
+		return nil
+	}
+	for _, branch := range cfg.Branches {
+		if gitOnBranch(p.PathRoot(), info.Commit, branch) {
+			return nil
+		}
+	}
+	return util.NewReadableError(nil, fmt.Sprintf("The stage \"%s\" can only be deployed from a commit on: %s", p.app.Stage, strings.Join(cfg.Branches, ", ")))
+}
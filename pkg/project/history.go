@@ -0,0 +1,88 @@
+package project
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"os/user"
+	"time"
+
+	"github.com/sst/ion/pkg/project/provider"
+)
+
+type HistoryEntry struct {
+	Command     string         `json:"command"`
+	User        string         `json:"user"`
+	Version     string         `json:"version"`
+	Git         *GitInfo       `json:"git,omitempty"`
+	Started     time.Time      `json:"started"`
+	Duration    float64        `json:"duration"`
+	Finished    bool           `json:"finished"`
+	Changes     map[string]int `json:"changes"`
+	Errors      []string       `json:"errors"`
+	OutputsHash string         `json:"outputsHash,omitempty"`
+}
+
+func currentUser() string {
+	u, err := user.Current()
+	if err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+func hashOutputs(outputs map[string]interface{}) string {
+	if len(outputs) == 0 {
+		return ""
+	}
+	data, err := json.Marshal(outputs)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// recordHistory appends the result of a stack command to the history of the
+// stage. Failing to do so should not fail the command.
+func (s *stack) recordHistory(command string, started time.Time, git *GitInfo, changes map[string]int, complete *CompleteEvent) {
+	entry := HistoryEntry{
+		Command:     command,
+		User:        currentUser(),
+		Version:     s.project.version,
+		Git:         git,
+		Started:     started,
+		Duration:    time.Since(started).Seconds(),
+		Finished:    complete.Finished,
+		Changes:     changes,
+		Errors:      []string{},
+		OutputsHash: hashOutputs(complete.Outputs),
+	}
+	for _, item := range complete.Errors {
+		entry.Errors = append(entry.Errors, item.Message)
+	}
+	err := provider.AppendHistory(s.project.home, s.project.app.Name, s.project.app.Stage, entry)
+	if err != nil {
+		slog.Error("failed to record history", "err", err)
+	}
+}
+
+// History returns the past stack commands of the stage, oldest first.
+func (s *stack) History() ([]HistoryEntry, error) {
+	raw, err := provider.GetHistory(s.project.home, s.project.app.Name, s.project.app.Stage)
+	if err != nil {
+		return nil, err
+	}
+	result := []HistoryEntry{}
+	for _, item := range raw {
+		var entry HistoryEntry
+		err := json.Unmarshal(item, &entry)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, entry)
+	}
+	return result, nil
+}
@@ -0,0 +1,111 @@
+package project
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os/exec"
+	"strings"
+)
+
+type Hooks struct {
+	PreDeploy  string `json:"preDeploy"`
+	PostDeploy string `json:"postDeploy"`
+	PreRemove  string `json:"preRemove"`
+	PostRemove string `json:"postRemove"`
+}
+
+type HookEvent struct {
+	Name    string
+	Command string
+}
+
+// hook returns the name and shell command of the hook that runs before or
+// after a stack command, if there is one.
+func (h *Hooks) hook(command string, post bool) (string, string) {
+	if h == nil {
+		return "", ""
+	}
+	switch {
+	case command == "up" && !post:
+		return "preDeploy", h.PreDeploy
+	case command == "up" && post:
+		return "postDeploy", h.PostDeploy
+	case command == "destroy" && !post:
+		return "preRemove", h.PreRemove
+	case command == "destroy" && post:
+		return "postRemove", h.PostRemove
+	}
+	return "", ""
+}
+
+// runHook runs a hook with sh in the project root and streams its output as
+// StdOutEvents. Post hooks also get the links and outputs of the stack, in
+// the same format as `sst shell`.
+func (s *stack) runHook(input *StackInput, post bool, env map[string]string, complete *CompleteEvent) error {
+	name, command := s.project.app.Hooks.hook(input.Command, post)
+	if command == "" {
+		return nil
+	}
+	slog.Info("running hook", "name", name, "command", command)
+	input.OnEvent(&StackEvent{HookEvent: &HookEvent{
+		Name:    name,
+		Command: command,
+	}})
+
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Dir = s.project.PathRoot()
+	for key, value := range env {
+		if key == "PULUMI_CONFIG_PASSPHRASE" {
+			continue
+		}
+		cmd.Env = append(cmd.Env, key+"="+value)
+	}
+	cmd.Env = append(cmd.Env,
+		"SST_APP="+s.project.app.Name,
+		"SST_STAGE="+s.project.app.Stage,
+	)
+	if complete != nil {
+		for key, value := range complete.Links {
+			data, err := json.Marshal(value)
+			if err != nil {
+				return err
+			}
+			cmd.Env = append(cmd.Env, fmt.Sprintf("SST_RESOURCE_%s=%s", key, data))
+		}
+		for key, value := range complete.Outputs {
+			str, ok := value.(string)
+			if !ok {
+				data, err := json.Marshal(value)
+				if err != nil {
+					return err
+				}
+				str = string(data)
+			}
+			cmd.Env = append(cmd.Env, fmt.Sprintf("SST_OUTPUT_%s=%s", key, str))
+		}
+	}
+
+	reader, writer := io.Pipe()
+	cmd.Stdout = writer
+	cmd.Stderr = writer
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		scanner := bufio.NewScanner(reader)
+		for scanner.Scan() {
+			input.OnEvent(&StackEvent{StdOutEvent: &StdOutEvent{
+				Text: scanner.Text(),
+			}})
+		}
+	}()
+	err := cmd.Run()
+	writer.Close()
+	<-done
+	if err != nil {
+		return fmt.Errorf("%s hook failed: %s: %w", name, strings.TrimSpace(command), err)
+	}
+	return nil
+}
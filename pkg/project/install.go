@@ -147,6 +147,7 @@ func (p *Project) writeTypes() error {
 	file.WriteString(`      app(input: AppInput): Omit<App, "providers"> & Providers;` + "\n")
 	file.WriteString(`    },` + "\n")
 	file.WriteString(`  ) => Config;` + "\n")
+	file.WriteString(`  export const $secret: <T>(value: T) => T;` + "\n")
 	file.WriteString(`}` + "\n")
 
 	return nil
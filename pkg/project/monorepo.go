@@ -0,0 +1,114 @@
+package project
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/sst/ion/internal/fs"
+)
+
+// DiscoverAll finds every sst.config.ts in the repo the current directory is
+// in, or under the current directory if it is not in a git repo.
+func DiscoverAll() ([]string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	root := cwd
+	if top, err := git(cwd, "rev-parse", "--show-toplevel"); err == nil && top != "" {
+		root = top
+	}
+	configs, err := fs.FindDown(root, "sst.config.ts")
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(configs)
+	for _, cfgPath := range configs {
+		err = os.MkdirAll(ResolveWorkingDir(cfgPath), 0755)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return configs, nil
+}
+
+// ConfigRefs returns the names of the apps that a config, or a file it
+// imports, references with $ref in the given stage. It reads the source so
+// the order can be worked out before anything is evaluated. Refs to other
+// stages are left out, since they are not deployed alongside it.
+func ConfigRefs(cfgPath string, stage string) ([]string, error) {
+	refs, err := configRefs(cfgPath)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	result := []string{}
+	for _, item := range refs {
+		if item.Stage != "" && item.Stage != stage {
+			continue
+		}
+		if !seen[item.App] {
+			seen[item.App] = true
+			result = append(result, item.App)
+		}
+	}
+	return result, nil
+}
+
+// SortApps checks that the references between apps do not form a cycle.
+// The refs map each app to the apps it depends on, references to apps that
+// are not in the map are ignored.
+func SortApps(refs map[string][]string) ([]string, error) {
+	names := []string{}
+	for name := range refs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := []string{}
+	state := map[string]int{}
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch state[name] {
+		case 1:
+			return fmt.Errorf("apps reference each other in a cycle: %s", strings.Join(append(path, name), " -> "))
+		case 2:
+			return nil
+		}
+		state[name] = 1
+		for _, dep := range refs[name] {
+			if _, ok := refs[dep]; !ok || dep == name {
+				continue
+			}
+			if err := visit(dep, append(path, name)); err != nil {
+				return err
+			}
+		}
+		state[name] = 2
+		result = append(result, name)
+		return nil
+	}
+	for _, name := range names {
+		if err := visit(name, nil); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// RelativeConfig is the path of the config relative to the current directory,
+// for printing.
+func RelativeConfig(cfgPath string) string {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return cfgPath
+	}
+	rel, err := filepath.Rel(cwd, cfgPath)
+	if err != nil {
+		return cfgPath
+	}
+	return rel
+}
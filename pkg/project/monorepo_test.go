@@ -0,0 +1,110 @@
+package project
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestConfigRefs(t *testing.T) {
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "sst.config.ts")
+	err := os.WriteFile(cfgPath, []byte(`
+const api = $ref("api", "production");
+const web = $ref("web");
+export default { async run() { await import("./infra/auth"); } };
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.MkdirAll(filepath.Join(dir, "infra"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(dir, "infra", "auth.ts"), []byte(`
+export const auth = $ref( 'auth', $app.stage);
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refs, err := ConfigRefs(cfgPath, "production")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(refs, []string{"api", "web", "auth"}) {
+		t.Errorf("unexpected refs %v", refs)
+	}
+	// the ref to production is not part of a deploy of dev
+	refs, err = ConfigRefs(cfgPath, "dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(refs, []string{"web", "auth"}) {
+		t.Errorf("unexpected refs in dev %v", refs)
+	}
+}
+
+func TestSortApps(t *testing.T) {
+	order, err := SortApps(map[string][]string{
+		"web":  {"api", "external"},
+		"api":  {"auth"},
+		"auth": {},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(order, []string{"auth", "api", "web"}) {
+		t.Errorf("unexpected order %v", order)
+	}
+
+	_, err = SortApps(map[string][]string{
+		"web": {"api"},
+		"api": {"web"},
+	})
+	if err == nil {
+		t.Errorf("expected a cycle to fail")
+	}
+}
+
+func TestParseRefs(t *testing.T) {
+	refs, err := parseRefs(`
+$ref("api", "production");
+$ref("api", $app.stage);
+$ref("auth");
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []ref{
+		{App: "api", Stage: "production"},
+		{App: "api"},
+		{App: "auth"},
+	}
+	if !reflect.DeepEqual(refs, expected) {
+		t.Errorf("unexpected refs %v", refs)
+	}
+
+	refs, err = parseRefs(`
+// $ref(name) is resolved before the program runs
+/* $ref(name) */
+const help = "call $ref(name)";
+const text = ` + "`$ref(${name}) for ${$ref(\"web\").url}`" + `;
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(refs, []ref{{App: "web"}}) {
+		t.Errorf("unexpected refs in comments and strings %v", refs)
+	}
+
+	for _, source := range []string{
+		`$ref("web", process.env.STAGE)`,
+		`$ref(name)`,
+		"$ref(`${name}`)",
+	} {
+		if _, err := parseRefs(source); err == nil {
+			t.Errorf("expected %s to fail", source)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package project
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type NotificationsConfig struct {
+	Webhooks []Webhook `json:"webhooks"`
+}
+
+type Webhook struct {
+	URL string `json:"url"`
+	// Events to send, one of started, succeeded, or failed. Defaults to all.
+	Events []string `json:"events"`
+	// Secret used to sign the payload in the X-SST-Signature header
+	Secret string `json:"secret"`
+}
+
+type Notification struct {
+	Event    string                 `json:"event"`
+	App      string                 `json:"app"`
+	Stage    string                 `json:"stage"`
+	Command  string                 `json:"command"`
+	User     string                 `json:"user"`
+	Git      *GitInfo               `json:"git,omitempty"`
+	Started  time.Time              `json:"started"`
+	Duration float64                `json:"duration"`
+	Outputs  map[string]interface{} `json:"outputs"`
+	Errors   []Error                `json:"errors"`
+}
+
+const (
+	NotificationStarted   = "started"
+	NotificationSucceeded = "succeeded"
+	NotificationFailed    = "failed"
+)
+
+const SignatureHeader = "X-SST-Signature"
+
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// webhookRetries is the number of attempts for a webhook, with backoff
+// starting at webhookBackoff.
+var webhookRetries = 3
+var webhookBackoff = time.Second
+
+func (w *Webhook) wants(event string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, item := range w.Events {
+		if item == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of the payload, prefixed with the
+// algorithm.
+func Sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Send posts the notification to the webhook, retrying on network errors and
+// 5xx or 429 responses.
+func (w *Webhook) Send(notification *Notification) error {
+	payload, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+	backoff := webhookBackoff
+	for attempt := 1; ; attempt++ {
+		retry, err := w.post(payload)
+		if err == nil || !retry || attempt >= webhookRetries {
+			return err
+		}
+		slog.Info("retrying webhook", "url", w.URL, "attempt", attempt, "err", err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// post sends the payload once. It returns if the request can be retried.
+func (w *Webhook) post(payload []byte) (bool, error) {
+	req, err := http.NewRequest("POST", w.URL, bytes.NewReader(payload))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "sst")
+	if w.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(w.Secret, payload))
+	}
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		return retry, fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+	return false, nil
+}
+
+// notify sends the event to every webhook that wants it. Failing to notify
+// should not fail the command.
+func (s *stack) notify(event string, command string, started time.Time, git *GitInfo, complete *CompleteEvent) {
+	cfg := s.project.app.Notifications
+	if cfg == nil || len(cfg.Webhooks) == 0 {
+		return
+	}
+	notification := &Notification{
+		Event:   event,
+		App:     s.project.app.Name,
+		Stage:   s.project.app.Stage,
+		Command: command,
+		User:    currentUser(),
+		Git:     git,
+		Started: started,
+		Outputs: map[string]interface{}{},
+		Errors:  []Error{},
+	}
+	if complete != nil {
+		notification.Duration = time.Since(started).Seconds()
+		notification.Outputs = complete.Outputs
+		notification.Errors = complete.Errors
+	}
+
+	var wg sync.WaitGroup
+	for _, webhook := range cfg.Webhooks {
+		if !webhook.wants(event) {
+			continue
+		}
+		wg.Add(1)
+		go func(webhook Webhook) {
+			defer wg.Done()
+			err := webhook.Send(notification)
+			if err != nil {
+				slog.Error("failed to send webhook", "url", webhook.URL, "err", err)
+			}
+		}(webhook)
+	}
+	wg.Wait()
+}
+
+func (s *stack) notifyComplete(command string, started time.Time, git *GitInfo, complete *CompleteEvent) {
+	event := NotificationSucceeded
+	if len(complete.Errors) > 0 || !complete.Finished {
+		event = NotificationFailed
+	}
+	s.notify(event, command, started, git, complete)
+}
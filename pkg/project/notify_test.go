@@ -0,0 +1,57 @@
+package project
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWebhookSend(t *testing.T) {
+	webhookBackoff = time.Millisecond
+	attempts := 0
+	var signature string
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		signature = r.Header.Get(SignatureHeader)
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	webhook := &Webhook{URL: server.URL, Secret: "secret"}
+	err := webhook.Send(&Notification{Event: NotificationSucceeded, Stage: "production"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 2 {
+		t.Errorf("expected 2 attempts, got %d", attempts)
+	}
+	if signature != Sign("secret", body) {
+		t.Errorf("signature %q does not match payload", signature)
+	}
+}
+
+func TestWebhookSendClientError(t *testing.T) {
+	webhookBackoff = time.Millisecond
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	webhook := &Webhook{URL: server.URL}
+	err := webhook.Send(&Notification{Event: NotificationFailed, Stage: "production"})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if attempts != 1 {
+		t.Errorf("expected 1 attempt, got %d", attempts)
+	}
+}
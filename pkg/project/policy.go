@@ -0,0 +1,215 @@
+package project
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/common/apitype"
+	"github.com/sst/ion/pkg/js"
+	"gopkg.in/yaml.v3"
+)
+
+// PolicyRule is a declarative check on the inputs of every planned resource
+// that matches Type. A Type ending in * matches every type that starts with
+// it, and Property is a dot separated path into the inputs.
+type PolicyRule struct {
+	Name     string        `json:"name" yaml:"name"`
+	Message  string        `json:"message" yaml:"message"`
+	Type     string        `json:"type" yaml:"type"`
+	Property string        `json:"property" yaml:"property"`
+	Required bool          `json:"required" yaml:"required"`
+	In       []interface{} `json:"in" yaml:"in"`
+	NotIn    []interface{} `json:"notIn" yaml:"notIn"`
+}
+
+type PolicyFile struct {
+	Rules []PolicyRule `json:"rules" yaml:"rules"`
+}
+
+// PlannedResource is a resource as it will be after the deploy, taken from
+// the preview.
+type PlannedResource struct {
+	URN    string                 `json:"urn"`
+	Type   string                 `json:"type"`
+	Op     apitype.OpType         `json:"op"`
+	Inputs map[string]interface{} `json:"inputs"`
+}
+
+type policies struct {
+	rules  []PolicyRule
+	script string
+}
+
+var policyFiles = []string{"sst.policy.json", "sst.policy.yaml", "sst.policy.yml"}
+var policyScript = "sst.policy.ts"
+
+// loadPolicies reads the declarative rules and finds the policy script next
+// to sst.config.ts. It returns nil if there are none.
+func (p *Project) loadPolicies() (*policies, error) {
+	result := &policies{}
+	for _, name := range policyFiles {
+		data, err := os.ReadFile(filepath.Join(p.PathRoot(), name))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		var file PolicyFile
+		if strings.HasSuffix(name, ".json") {
+			err = json.Unmarshal(data, &file)
+		} else {
+			err = yaml.Unmarshal(data, &file)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+		}
+		result.rules = append(result.rules, file.Rules...)
+	}
+	script := filepath.Join(p.PathRoot(), policyScript)
+	if _, err := os.Stat(script); err == nil {
+		result.script = script
+	}
+	if len(result.rules) == 0 && result.script == "" {
+		return nil, nil
+	}
+	return result, nil
+}
+
+func (r *PolicyRule) matches(resourceType string) bool {
+	if r.Type == "" {
+		return true
+	}
+	if strings.HasSuffix(r.Type, "*") {
+		return strings.HasPrefix(resourceType, strings.TrimSuffix(r.Type, "*"))
+	}
+	return r.Type == resourceType
+}
+
+// Check returns a message if the resource violates the rule.
+func (r *PolicyRule) Check(resource PlannedResource) (string, bool) {
+	if !r.matches(resource.Type) {
+		return "", false
+	}
+	value, ok := lookupProperty(resource.Inputs, r.Property)
+	reason := ""
+	switch {
+	case !ok && r.Required:
+		reason = fmt.Sprintf("\"%s\" is required", r.Property)
+	case ok && len(r.In) > 0 && !containsValue(r.In, value):
+		reason = fmt.Sprintf("\"%s\" is %v, expected one of %v", r.Property, value, r.In)
+	case ok && containsValue(r.NotIn, value):
+		reason = fmt.Sprintf("\"%s\" cannot be %v", r.Property, value)
+	default:
+		return "", false
+	}
+	if r.Message != "" {
+		reason = r.Message
+	}
+	if r.Name != "" {
+		reason = r.Name + ": " + reason
+	}
+	return reason, true
+}
+
+func lookupProperty(inputs map[string]interface{}, path string) (interface{}, bool) {
+	var current interface{} = inputs
+	for _, key := range strings.Split(path, ".") {
+		casted, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		current, ok = casted[key]
+		if !ok || current == nil {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+func containsValue(list []interface{}, value interface{}) bool {
+	for _, item := range list {
+		if fmt.Sprint(item) == fmt.Sprint(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// check runs the rules and the policy script against the planned resources
+// and returns the violations.
+func (p *policies) check(proj *Project, resources []PlannedResource) ([]Error, error) {
+	violations := []Error{}
+	for _, resource := range resources {
+		for _, rule := range p.rules {
+			if message, ok := rule.Check(resource); ok {
+				violations = append(violations, Error{
+					Message: message,
+					URN:     resource.URN,
+				})
+			}
+		}
+	}
+	if p.script == "" {
+		return violations, nil
+	}
+
+	slog.Info("running policy script", "path", p.script)
+	buildResult, err := js.Build(js.EvalOptions{
+		Dir: proj.PathWorkingDir(),
+		Code: fmt.Sprintf(`
+import fs from "fs";
+import mod from '%s';
+const policies = [mod].flat();
+const resources = JSON.parse(fs.readFileSync(0, "utf8"));
+const violations = [];
+for (const resource of resources) {
+  for (const policy of policies) {
+    const result = await policy(resource);
+    if (!result) continue;
+    for (const message of [result].flat()) {
+      violations.push({ Message: message, URN: resource.urn });
+    }
+  }
+}
+console.log("~j" + JSON.stringify(violations));`,
+			p.script),
+	})
+	if err != nil {
+		return nil, err
+	}
+	input, err := json.Marshal(resources)
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command("node", "--no-warnings", buildResult.OutputFiles[0].Path)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stderr = os.Stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to run %s: %w", policyScript, err)
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	scanner.Buffer(nil, 64*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "~j") {
+			fmt.Println(line)
+			continue
+		}
+		var result []Error
+		err := json.Unmarshal([]byte(line[2:]), &result)
+		if err != nil {
+			return nil, err
+		}
+		violations = append(violations, result...)
+	}
+	return violations, scanner.Err()
+}
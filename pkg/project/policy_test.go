@@ -0,0 +1,30 @@
+package project
+
+import "testing"
+
+func TestPolicyRuleCheck(t *testing.T) {
+	bucket := PlannedResource{
+		URN:  "urn:pulumi:dev::app::aws:s3/bucketV2:BucketV2::Assets",
+		Type: "aws:s3/bucketV2:BucketV2",
+		Inputs: map[string]interface{}{
+			"acl":  "public-read",
+			"tags": map[string]interface{}{"team": "web"},
+		},
+	}
+	cases := []struct {
+		rule     PolicyRule
+		violates bool
+	}{
+		{PolicyRule{Type: "aws:s3/*", Property: "acl", NotIn: []interface{}{"public-read"}}, true},
+		{PolicyRule{Type: "aws:s3/*", Property: "acl", In: []interface{}{"private"}}, true},
+		{PolicyRule{Type: "aws:*", Property: "tags.team", Required: true}, false},
+		{PolicyRule{Type: "aws:*", Property: "tags.owner", Required: true}, true},
+		{PolicyRule{Type: "aws:dynamodb/*", Property: "tags.owner", Required: true}, false},
+	}
+	for i, item := range cases {
+		_, violates := item.rule.Check(bucket)
+		if violates != item.violates {
+			t.Errorf("case %d: expected violation to be %v", i, item.violates)
+		}
+	}
+}
@@ -5,12 +5,14 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/sst/ion/internal/fs"
@@ -25,12 +27,82 @@ type App struct {
 	Removal   string                 `json:"removal"`
 	Providers map[string]interface{} `json:"providers"`
 	Home      string                 `json:"home"`
+	Protected []string               `json:"protected"`
+	// Protect is either a boolean or a list of stage names
+	Protect       interface{}          `json:"protect"`
+	Git           *GitConfig           `json:"git"`
+	Hooks         *Hooks               `json:"hooks"`
+	Notifications *NotificationsConfig `json:"notifications"`
+	Retry         *RetryConfig         `json:"retry"`
+	// Stages overrides the config for the stages that match a pattern
+	Stages map[string]StageConfig `json:"stages"`
+	// Plugins are the args of the home plugins, by plugin name
+	Plugins map[string]map[string]interface{} `json:"plugins"`
 	// Deprecated: Backend is now Home
 	Backend string `json:"backend"`
 	// Deprecated: RemovalPolicy is now Removal
 	RemovalPolicy string `json:"removalPolicy"`
 }
 
+// DefaultProtected are the resource types that need to be confirmed before
+// they are replaced or deleted, if "protected" is not set in the config.
+var DefaultProtected = []string{
+	"aws:s3/bucket:Bucket",
+	"aws:s3/bucketV2:BucketV2",
+	"aws:dynamodb/table:Table",
+	"aws:rds/*",
+	"aws:efs/fileSystem:FileSystem",
+	"cloudflare:index/r2Bucket:R2Bucket",
+	"cloudflare:index/d1Database:D1Database",
+	"cloudflare:index/workersKvNamespace:WorkersKvNamespace",
+}
+
+// IsProtected checks if the resource type matches one of the protected
+// types. A type ending in * matches every type that starts with it.
+func (a *App) IsProtected(resourceType string) bool {
+	for _, item := range a.Protected {
+		if strings.HasSuffix(item, "*") && strings.HasPrefix(resourceType, strings.TrimSuffix(item, "*")) {
+			return true
+		}
+		if item == resourceType {
+			return true
+		}
+	}
+	return false
+}
+
+// IsStageProtected checks if destructive commands should be refused for the
+// current stage.
+func (a *App) IsStageProtected() bool {
+	switch value := a.Protect.(type) {
+	case bool:
+		return value
+	case []interface{}:
+		for _, item := range value {
+			if stage, ok := item.(string); ok && stage == a.Stage {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type GitConfig struct {
+	// Stages that can only be deployed from a clean working tree
+	Stages []string `json:"stages"`
+	// Branches the deployed commit has to be on
+	Branches []string `json:"branches"`
+}
+
+func (g *GitConfig) HasStage(stage string) bool {
+	for _, item := range g.Stages {
+		if item == stage {
+			return true
+		}
+	}
+	return false
+}
+
 type Project struct {
 	version   string
 	root      string
@@ -113,6 +185,7 @@ func New(input *ProjectConfig) (*Project, error) {
 			Dir: tmp,
 			Banner: `
       function $config(input) { return input }
+      function $secret(value) { return { ` + secretKey + `: value } }
       `,
 			Define: map[string]string{
 				"$input": string(inputBytes),
@@ -154,8 +227,9 @@ console.log("~j" + JSON.stringify(mod.app({
 			proj.app = &parsed
 			proj.app.Stage = input.Stage
 
-			if proj.app.Providers == nil {
-				proj.app.Providers = map[string]interface{}{}
+			err = proj.app.applyStages()
+			if err != nil {
+				return nil, util.NewReadableError(err, "Invalid stage config: "+err.Error())
 			}
 
 			for name, args := range proj.app.Providers {
@@ -164,7 +238,9 @@ console.log("~j" + JSON.stringify(mod.app({
 				}
 			}
 
-			if _, ok := proj.app.Providers[proj.app.Home]; !ok {
+			// home plugins are not pulumi providers, their args are in "plugins"
+			_, ok := proj.app.Providers[proj.app.Home]
+			if !ok && !strings.HasPrefix(proj.app.Home, provider.PluginPrefix) {
 				proj.app.Providers[proj.app.Home] = map[string]interface{}{}
 			}
 
@@ -184,6 +260,10 @@ console.log("~j" + JSON.stringify(mod.app({
 				proj.app.Removal = "retain"
 			}
 
+			if proj.app.Protected == nil {
+				proj.app.Protected = DefaultProtected
+			}
+
 			if proj.app.Removal != "remove" && proj.app.Removal != "retain" && proj.app.Removal != "retain-all" {
 				return nil, fmt.Errorf("Removal must be one of: remove, retain, retain-all")
 			}
@@ -200,16 +280,26 @@ console.log("~j" + JSON.stringify(mod.app({
 }
 
 func (proj *Project) LoadProviders() error {
+	return proj.loadProviders(false)
+}
+
+// LoadProvidersForBootstrap loads the providers without creating or migrating
+// the bootstrap of the home, so it can be planned with Bootstrapper first.
+func (proj *Project) LoadProvidersForBootstrap() error {
+	return proj.loadProviders(true)
+}
+
+func (proj *Project) loadProviders(deferBootstrap bool) error {
 	proj.Providers = map[string]provider.Provider{}
 	for name, args := range proj.app.Providers {
 		var p provider.Provider
 
 		if name == "aws" {
-			p = &provider.AwsProvider{}
+			p = &provider.AwsProvider{DeferBootstrap: deferBootstrap}
 		}
 
 		if name == "cloudflare" {
-			p = &provider.CloudflareProvider{}
+			p = &provider.CloudflareProvider{DeferBootstrap: deferBootstrap}
 		}
 
 		if p == nil {
@@ -223,6 +313,20 @@ func (proj *Project) LoadProviders() error {
 		proj.Providers[name] = p
 	}
 
+	if name, ok := strings.CutPrefix(proj.app.Home, provider.PluginPrefix); ok {
+		p := &provider.PluginProvider{Name: name, Dir: proj.root}
+		args := proj.app.Plugins[name]
+		if args == nil {
+			args = map[string]interface{}{}
+		}
+		err := p.Init(proj.app.Name, proj.app.Stage, args)
+		if err != nil {
+			return fmt.Errorf("Error initializing %s:\n   %w", proj.app.Home, err)
+		}
+		proj.home = p
+		return nil
+	}
+
 	p := proj.Providers[proj.app.Home]
 	casted, ok := p.(provider.Home)
 	if !ok {
@@ -233,6 +337,38 @@ func (proj *Project) LoadProviders() error {
 	return nil
 }
 
+// providerEnv merges the env of every provider, so their args reach pulumi
+// even when they are not the home. The home is applied last and wins.
+func (proj *Project) providerEnv() (map[string]string, error) {
+	env := map[string]string{}
+	names := make([]string, 0, len(proj.Providers))
+	for name := range proj.Providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p, ok := proj.Providers[name].(provider.Home)
+		if !ok || p == proj.home {
+			continue
+		}
+		providerEnv, err := p.Env()
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range providerEnv {
+			env[key] = value
+		}
+	}
+	homeEnv, err := proj.home.Env()
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range homeEnv {
+		env[key] = value
+	}
+	return env, nil
+}
+
 func (p *Project) getPath(path ...string) string {
 	paths := append([]string{p.PathWorkingDir()}, path...)
 	return filepath.Join(paths...)
@@ -242,6 +378,12 @@ func (p *Project) PathWorkingDir() string {
 	return filepath.Join(p.root, ".sst")
 }
 
+// PathStageDir is the working directory of the current stage, so stages of
+// the same app can run at the same time without sharing any pulumi files.
+func (p *Project) PathStageDir() string {
+	return filepath.Join(p.PathWorkingDir(), "stages", p.app.Stage)
+}
+
 func (p *Project) PathPlatformDir() string {
 	return filepath.Join(p.PathWorkingDir(), "platform")
 }
@@ -267,6 +409,15 @@ func (p *Project) Backend() provider.Home {
 }
 
 func (p *Project) Cleanup() error {
+	if closer, ok := p.home.(io.Closer); ok {
+		closer.Close()
+	}
+	err := os.RemoveAll(
+		filepath.Join(p.PathStageDir(), "artifacts"),
+	)
+	if err != nil {
+		return err
+	}
 	return os.RemoveAll(
 		filepath.Join(p.PathWorkingDir(), "artifacts"),
 	)
@@ -12,24 +12,33 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/ssm"
-	"github.com/sst/ion/internal/util"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
 
 	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
 	ssmTypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
 )
 
 type AwsProvider struct {
-	args        map[string]interface{}
-	config      aws.Config
-	bootstrap   *awsBootstrapData
-	credentials sync.Once
+	// DeferBootstrap skips creating or migrating the bootstrap in Init, so it
+	// can be planned and confirmed before calling Bootstrap.
+	DeferBootstrap bool
+
+	args            map[string]interface{}
+	config          aws.Config
+	bootstrap       *awsBootstrapData
+	bootstrapConfig awsBootstrapConfig
+	credentials     sync.Once
 }
 
+// Env returns the current credentials. They are refreshed before they expire,
+// so call it again when starting a process instead of reusing the result.
 func (a *AwsProvider) Env() (map[string]string, error) {
 	creds, err := a.config.Credentials.Retrieve(context.Background())
 	if err != nil {
@@ -42,6 +51,9 @@ func (a *AwsProvider) Env() (map[string]string, error) {
 	env["AWS_SESSION_TOKEN"] = creds.SessionToken
 	env["AWS_DEFAULT_REGION"] = a.config.Region
 	env["AWS_REGION"] = a.config.Region
+	if a.bootstrap != nil && a.bootstrap.PermissionsBoundary != "" {
+		env["SST_AWS_PERMISSIONS_BOUNDARY"] = a.bootstrap.PermissionsBoundary
+	}
 
 	return env, nil
 }
@@ -144,8 +156,6 @@ func (a *AwsProvider) Cancel(app string, stage string) error {
 	return nil
 }
 
-const BOOTSTRAP_VERSION = 1
-
 func (a *AwsProvider) Init(app string, stage string, args map[string]interface{}) (err error) {
 	a.args = args
 
@@ -158,17 +168,38 @@ func (a *AwsProvider) Init(app string, stage string, args map[string]interface{}
 	}
 	a.config = cfg
 
-	bootstrap, err := a.resolveBuckets()
+	err = a.resolveBootstrapConfig()
+	if err != nil {
+		return err
+	}
+	bootstrap, err := a.loadBootstrap()
 	if err != nil {
 		return err
 	}
 	a.bootstrap = bootstrap
+	if err := a.checkBootstrapVersion(); err != nil {
+		return err
+	}
+	// a missing bootstrap is created, but an existing one is only migrated by
+	// sst bootstrap since that needs more permissions than the other commands
+	if !a.DeferBootstrap && bootstrap == nil {
+		err = a.Bootstrap()
+		if err != nil {
+			return err
+		}
+	}
+	if a.BootstrapOutdated() {
+		slog.Info("the bootstrap is outdated, run sst bootstrap to migrate it", "version", bootstrap.Version)
+	}
 
 	// creds, err := cfg.Credentials.Retrieve(context.TODO())
 	// if err != nil {
 	// 	return err
 	// }
 	delete(args, "profile")
+	// the credentials handed to pulumi are already for the assumed role, they
+	// are not refreshed during the deploy so the role duration has to cover it
+	delete(args, "assumeRole")
 	// if creds.AccessKeyID != "" {
 	// 	args["accessKey"] = creds.AccessKeyID
 	// }
@@ -183,6 +214,16 @@ func (a *AwsProvider) Init(app string, stage string, args map[string]interface{}
 	// 	args["region"] = cfg.Region
 	// }
 
+	if defaultTags, ok := args["defaultTags"].(map[string]interface{}); ok {
+		tags, ok := defaultTags["tags"].(map[string]interface{})
+		if !ok {
+			tags = map[string]interface{}{}
+			defaultTags["tags"] = tags
+		}
+		tags["sst:app"] = app
+		tags["sst:stage"] = stage
+		return nil
+	}
 	tags, err := json.Marshal(map[string]interface{}{
 		"tags": map[string]string{
 			"sst:app":   app,
@@ -197,117 +238,22 @@ func (a *AwsProvider) Init(app string, stage string, args map[string]interface{}
 	return err
 }
 
-type awsBootstrapData struct {
-	Version int    `json:"version"`
-	Asset   string `json:"asset"`
-	State   string `json:"state"`
-}
-
-func (a *AwsProvider) resolveBuckets() (*awsBootstrapData, error) {
-	ctx := context.TODO()
-
-	ssmClient := ssm.NewFromConfig(a.config)
-	slog.Info("fetching bootstrap")
-	result, err := ssmClient.GetParameter(ctx, &ssm.GetParameterInput{
-		Name:           aws.String(SSM_NAME_BOOTSTRAP),
-		WithDecryption: aws.Bool(false),
-	})
-
-	if result != nil && result.Parameter.Value != nil {
-		slog.Info("found existing bootstrap", "data", *result.Parameter.Value)
-		var bootstrapData awsBootstrapData
-		err = json.Unmarshal([]byte(*result.Parameter.Value), &bootstrapData)
-		if err != nil {
-			return nil, err
-		}
-		return &bootstrapData, nil
-	}
-	if err != nil {
-		var pnf *ssmTypes.ParameterNotFound
-		if !errors.As(err, &pnf) {
-			return nil, err
-		}
-	}
-
-	region := a.config.Region
-	rand := util.RandomString(12)
-	assetName := fmt.Sprintf("sst-asset-%v", rand)
-	stateName := fmt.Sprintf("sst-state-%v", rand)
-	slog.Info("creating bootstrap bucket", "name", assetName)
-	s3Client := s3.NewFromConfig(a.config)
-
-	var config *s3types.CreateBucketConfiguration = nil
-	if region != "us-east-1" {
-		config = &s3types.CreateBucketConfiguration{
-			LocationConstraint: s3types.BucketLocationConstraint(region),
-		}
-	}
-	_, err = s3Client.CreateBucket(context.TODO(), &s3.CreateBucketInput{
-		Bucket:                    aws.String(assetName),
-		CreateBucketConfiguration: config,
-	})
-	if err != nil {
-		return nil, err
-	}
-
-	_, err = s3Client.PutBucketNotificationConfiguration(context.TODO(), &s3.PutBucketNotificationConfigurationInput{
-		Bucket:                    aws.String(assetName),
-		NotificationConfiguration: &s3types.NotificationConfiguration{},
-	})
-	if err != nil {
-		return nil, err
-	}
-
-	_, err = s3Client.CreateBucket(context.TODO(), &s3.CreateBucketInput{
-		Bucket:                    aws.String(stateName),
-		CreateBucketConfiguration: config,
-	})
-	if err != nil {
-		return nil, err
-	}
-
-	_, err = s3Client.PutBucketVersioning(context.TODO(), &s3.PutBucketVersioningInput{
-		Bucket: aws.String(stateName),
-		VersioningConfiguration: &s3types.VersioningConfiguration{
-			Status: s3types.BucketVersioningStatusEnabled,
-		},
-	})
-	if err != nil {
-		return nil, err
-	}
-
-	bootstrapData := &awsBootstrapData{
-		Version: BOOTSTRAP_VERSION,
-		Asset:   assetName,
-		State:   stateName,
-	}
-
-	data, err := json.Marshal(bootstrapData)
-
-	_, err = ssmClient.PutParameter(
-		ctx,
-		&ssm.PutParameterInput{
-			Name:  aws.String(SSM_NAME_BOOTSTRAP),
-			Type:  ssmTypes.ParameterTypeString,
-			Value: aws.String(string(data)),
-		},
-	)
-	if err != nil {
-		return nil, err
-	}
-
-	return bootstrapData, nil
-}
+// credentialsExpiryWindow is how long before they expire credentials are
+// refreshed, so the ones handed out are valid long enough to be used.
+const credentialsExpiryWindow = 5 * time.Minute
 
 func (a *AwsProvider) resolveConfig() (aws.Config, error) {
 	ctx := context.Background()
 	cfg, err := config.LoadDefaultConfig(
 		ctx,
+		config.WithCredentialsCacheOptions(func(o *aws.CredentialsCacheOptions) {
+			o.ExpiryWindow = credentialsExpiryWindow
+		}),
 		func(lo *config.LoadOptions) error {
-			if profile, ok := a.args["profile"].(string); ok && profile != "" {
+			if profile := argString(a.args["profile"]); profile != "" {
 				lo.SharedConfigProfile = profile
 			}
-			if region, ok := a.args["region"].(string); ok && region != "" {
+			if region := argString(a.args["region"]); region != "" {
 				lo.Region = region
 				lo.DefaultRegion = "us-east-1"
 			}
@@ -322,9 +268,81 @@ func (a *AwsProvider) resolveConfig() (aws.Config, error) {
 		return aws.Config{}, err
 	}
 	slog.Info("credentials found")
+
+	roles, err := parseAssumeRoles(a.args["assumeRole"])
+	if err != nil {
+		return aws.Config{}, err
+	}
+	for _, role := range roles {
+		slog.Info("assuming role", "arn", role.RoleArn)
+		client := sts.NewFromConfig(cfg)
+		cfg.Credentials = aws.NewCredentialsCache(stscreds.NewAssumeRoleProvider(client, role.RoleArn, func(o *stscreds.AssumeRoleOptions) {
+			if role.ExternalID != "" {
+				o.ExternalID = aws.String(role.ExternalID)
+			}
+			if role.SessionName != "" {
+				o.RoleSessionName = role.SessionName
+			}
+			if role.Duration > 0 {
+				o.Duration = role.Duration
+			}
+		}), func(o *aws.CredentialsCacheOptions) {
+			o.ExpiryWindow = credentialsExpiryWindow
+		})
+		_, err = cfg.Credentials.Retrieve(ctx)
+		if err != nil {
+			return aws.Config{}, fmt.Errorf("failed to assume role %v: %w", role.RoleArn, err)
+		}
+	}
 	return cfg, nil
 }
 
+type awsAssumeRole struct {
+	RoleArn     string
+	ExternalID  string
+	SessionName string
+	Duration    time.Duration
+}
+
+// parseAssumeRoles reads the assumeRole arg. It is either one role or a list
+// of roles that are assumed in order, each one with the credentials of the
+// previous one.
+func parseAssumeRoles(value interface{}) ([]awsAssumeRole, error) {
+	var items []interface{}
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case []interface{}:
+		items = v
+	default:
+		items = []interface{}{v}
+	}
+	roles := []awsAssumeRole{}
+	for _, item := range items {
+		args, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("assumeRole must be an object or a list of objects")
+		}
+		role := awsAssumeRole{
+			RoleArn:     argString(args["roleArn"]),
+			ExternalID:  argString(args["externalId"]),
+			SessionName: argString(args["sessionName"]),
+		}
+		if role.RoleArn == "" {
+			return nil, fmt.Errorf("assumeRole is missing a roleArn")
+		}
+		if duration := argString(args["duration"]); duration != "" {
+			parsed, err := time.ParseDuration(duration)
+			if err != nil {
+				return nil, fmt.Errorf("invalid assumeRole duration %q: %w", duration, err)
+			}
+			role.Duration = parsed
+		}
+		roles = append(roles, role)
+	}
+	return roles, nil
+}
+
 func (a *AwsProvider) getData(key, app, stage string) (io.Reader, error) {
 	s3Client := s3.NewFromConfig(a.config)
 
@@ -0,0 +1,397 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/sst/ion/internal/util"
+
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	ssmTypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+// BOOTSTRAP_VERSION is the version of the bootstrap this CLI creates. When it
+// changes, add a migration that brings older bootstraps up to date.
+const BOOTSTRAP_VERSION = 2
+
+type awsBootstrapData struct {
+	Version int    `json:"version"`
+	Asset   string `json:"asset"`
+	State   string `json:"state"`
+	// PermissionsBoundary is set on the IAM roles created by the apps
+	PermissionsBoundary string `json:"permissionsBoundary,omitempty"`
+}
+
+// awsBootstrapConfig is read from the bootstrap provider arg. It only applies
+// when the bootstrap is created.
+type awsBootstrapConfig struct {
+	AssetBucket string            `json:"assetBucket"`
+	StateBucket string            `json:"stateBucket"`
+	Versioning  *bool             `json:"versioning"`
+	KmsKey      string            `json:"kmsKey"`
+	LogBucket   string            `json:"logBucket"`
+	Tags        map[string]string `json:"tags"`
+	// PermissionsBoundary is the ARN of the policy set as the permissions
+	// boundary of the IAM roles created by the apps.
+	PermissionsBoundary string `json:"permissionsBoundary"`
+}
+
+type awsBootstrapMigration struct {
+	Description string
+	Run         func(a *AwsProvider) error
+}
+
+// awsBootstrapMigrations are keyed by the version they migrate to.
+var awsBootstrapMigrations = map[int]awsBootstrapMigration{
+	2: {
+		Description: "Block public access to the state bucket",
+		Run: func(a *AwsProvider) error {
+			return a.blockPublicAccess(a.bootstrap.State)
+		},
+	},
+}
+
+func (a *AwsProvider) resolveBootstrapConfig() error {
+	value, ok := a.args["bootstrap"]
+	if !ok {
+		return nil
+	}
+	delete(a.args, "bootstrap")
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(data, &a.bootstrapConfig)
+	if err != nil {
+		return util.NewReadableError(err, "Invalid bootstrap config for aws: "+err.Error())
+	}
+	return nil
+}
+
+// loadBootstrap reads the bootstrap from SSM, it is nil if there is none.
+func (a *AwsProvider) loadBootstrap() (*awsBootstrapData, error) {
+	ssmClient := ssm.NewFromConfig(a.config)
+	slog.Info("fetching bootstrap")
+	result, err := ssmClient.GetParameter(context.TODO(), &ssm.GetParameterInput{
+		Name:           aws.String(SSM_NAME_BOOTSTRAP),
+		WithDecryption: aws.Bool(false),
+	})
+	if err != nil {
+		var pnf *ssmTypes.ParameterNotFound
+		if errors.As(err, &pnf) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	slog.Info("found existing bootstrap", "data", *result.Parameter.Value)
+	var bootstrapData awsBootstrapData
+	err = json.Unmarshal([]byte(*result.Parameter.Value), &bootstrapData)
+	if err != nil {
+		return nil, err
+	}
+	// the first bootstraps did not always record a version
+	if bootstrapData.Version == 0 {
+		bootstrapData.Version = 1
+	}
+	return &bootstrapData, nil
+}
+
+func (a *AwsProvider) checkBootstrapVersion() error {
+	if a.bootstrap != nil && a.bootstrap.Version > BOOTSTRAP_VERSION {
+		return util.NewReadableError(nil, fmt.Sprintf("The bootstrap in %v is version %d, which is newer than this CLI supports. Upgrade the CLI to continue.", a.config.Region, a.bootstrap.Version))
+	}
+	return nil
+}
+
+// bootstrapMigrations returns the migrations that bring the bootstrap up to
+// the current version, in order.
+func (a *AwsProvider) bootstrapMigrations() ([]awsBootstrapMigration, error) {
+	result := []awsBootstrapMigration{}
+	for version := a.bootstrap.Version + 1; version <= BOOTSTRAP_VERSION; version++ {
+		migration, ok := awsBootstrapMigrations[version]
+		if !ok {
+			return nil, fmt.Errorf("there is no migration for the bootstrap in %v to version %d", a.config.Region, version)
+		}
+		result = append(result, migration)
+	}
+	return result, nil
+}
+
+// BootstrapOutdated is true if the bootstrap was created by an older version
+// of the CLI. It is only migrated by sst bootstrap.
+func (a *AwsProvider) BootstrapOutdated() bool {
+	return a.bootstrap != nil && a.bootstrap.Version < BOOTSTRAP_VERSION
+}
+
+// PlanBootstrap lists the changes Bootstrap would make.
+func (a *AwsProvider) PlanBootstrap() ([]string, error) {
+	if err := a.checkBootstrapVersion(); err != nil {
+		return nil, err
+	}
+	if a.bootstrap == nil {
+		asset, state := a.bootstrapNames()
+		cfg := a.bootstrapConfig
+		plan := []string{
+			fmt.Sprintf("Create the asset bucket %v in %v", asset, a.config.Region),
+			fmt.Sprintf("Create the state bucket %v in %v", state, a.config.Region),
+		}
+		if cfg.Versioning == nil || *cfg.Versioning {
+			plan = append(plan, "Enable versioning on the state bucket")
+		}
+		plan = append(plan, "Block public access to the state bucket")
+		if cfg.KmsKey != "" {
+			plan = append(plan, "Encrypt the state bucket with the KMS key "+cfg.KmsKey)
+		}
+		if cfg.LogBucket != "" {
+			plan = append(plan, "Log access to the state bucket to "+cfg.LogBucket)
+		}
+		if len(cfg.Tags) > 0 {
+			plan = append(plan, "Tag the buckets with "+formatTags(cfg.Tags))
+		}
+		if cfg.PermissionsBoundary != "" {
+			plan = append(plan, "Set the permissions boundary of the IAM roles created by your apps to "+cfg.PermissionsBoundary)
+		}
+		plan = append(plan, fmt.Sprintf("Store the bootstrap in the SSM parameter %v", SSM_NAME_BOOTSTRAP))
+		return plan, nil
+	}
+	migrations, err := a.bootstrapMigrations()
+	if err != nil {
+		return nil, err
+	}
+	plan := []string{}
+	for _, migration := range migrations {
+		plan = append(plan, migration.Description)
+	}
+	if len(plan) > 0 {
+		plan = append(plan, fmt.Sprintf("Update the bootstrap from version %d to %d", a.bootstrap.Version, BOOTSTRAP_VERSION))
+	}
+	return plan, nil
+}
+
+// Bootstrap creates the bootstrap if there is none, or migrates it to the
+// current version.
+func (a *AwsProvider) Bootstrap() error {
+	if err := a.checkBootstrapVersion(); err != nil {
+		return err
+	}
+	if a.bootstrap == nil {
+		bootstrap, err := a.createBootstrap()
+		if err != nil {
+			return err
+		}
+		a.bootstrap = bootstrap
+		return nil
+	}
+	if a.bootstrap.Version == BOOTSTRAP_VERSION {
+		return nil
+	}
+	migrations, err := a.bootstrapMigrations()
+	if err != nil {
+		return err
+	}
+	for index, migration := range migrations {
+		version := a.bootstrap.Version + index + 1
+		slog.Info("migrating bootstrap", "version", version)
+		err := migration.Run(a)
+		if err != nil {
+			return fmt.Errorf("failed to migrate the bootstrap to version %d: %w", version, err)
+		}
+	}
+	next := *a.bootstrap
+	next.Version = BOOTSTRAP_VERSION
+	err = a.putBootstrap(&next, true)
+	if err != nil {
+		return err
+	}
+	a.bootstrap = &next
+	return nil
+}
+
+// bootstrapNames picks the bucket names once, so the plan shows the same
+// names that are created.
+func (a *AwsProvider) bootstrapNames() (string, string) {
+	rand := util.RandomString(12)
+	if a.bootstrapConfig.AssetBucket == "" {
+		a.bootstrapConfig.AssetBucket = fmt.Sprintf("sst-asset-%v", rand)
+	}
+	if a.bootstrapConfig.StateBucket == "" {
+		a.bootstrapConfig.StateBucket = fmt.Sprintf("sst-state-%v", rand)
+	}
+	return a.bootstrapConfig.AssetBucket, a.bootstrapConfig.StateBucket
+}
+
+func (a *AwsProvider) createBootstrap() (*awsBootstrapData, error) {
+	ctx := context.TODO()
+	assetName, stateName := a.bootstrapNames()
+	cfg := a.bootstrapConfig
+	s3Client := s3.NewFromConfig(a.config)
+
+	slog.Info("creating bootstrap bucket", "name", assetName)
+	err := a.createAssetBucket(assetName)
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("creating bootstrap bucket", "name", stateName)
+	err = a.createBucket(stateName)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Versioning == nil || *cfg.Versioning {
+		_, err = s3Client.PutBucketVersioning(ctx, &s3.PutBucketVersioningInput{
+			Bucket: aws.String(stateName),
+			VersioningConfiguration: &s3types.VersioningConfiguration{
+				Status: s3types.BucketVersioningStatusEnabled,
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = a.blockPublicAccess(stateName)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.KmsKey != "" {
+		_, err = s3Client.PutBucketEncryption(ctx, &s3.PutBucketEncryptionInput{
+			Bucket: aws.String(stateName),
+			ServerSideEncryptionConfiguration: &s3types.ServerSideEncryptionConfiguration{
+				Rules: []s3types.ServerSideEncryptionRule{
+					{
+						ApplyServerSideEncryptionByDefault: &s3types.ServerSideEncryptionByDefault{
+							SSEAlgorithm:   s3types.ServerSideEncryptionAwsKms,
+							KMSMasterKeyID: aws.String(cfg.KmsKey),
+						},
+						BucketKeyEnabled: aws.Bool(true),
+					},
+				},
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.LogBucket != "" {
+		_, err = s3Client.PutBucketLogging(ctx, &s3.PutBucketLoggingInput{
+			Bucket: aws.String(stateName),
+			BucketLoggingStatus: &s3types.BucketLoggingStatus{
+				LoggingEnabled: &s3types.LoggingEnabled{
+					TargetBucket: aws.String(cfg.LogBucket),
+					TargetPrefix: aws.String(stateName + "/"),
+				},
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(cfg.Tags) > 0 {
+		tags := []s3types.Tag{}
+		for key, value := range cfg.Tags {
+			tags = append(tags, s3types.Tag{Key: aws.String(key), Value: aws.String(value)})
+		}
+		for _, bucket := range []string{assetName, stateName} {
+			_, err = s3Client.PutBucketTagging(ctx, &s3.PutBucketTaggingInput{
+				Bucket:  aws.String(bucket),
+				Tagging: &s3types.Tagging{TagSet: tags},
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	bootstrapData := &awsBootstrapData{
+		Version:             BOOTSTRAP_VERSION,
+		Asset:               assetName,
+		State:               stateName,
+		PermissionsBoundary: cfg.PermissionsBoundary,
+	}
+	err = a.putBootstrap(bootstrapData, false)
+	if err != nil {
+		return nil, err
+	}
+	return bootstrapData, nil
+}
+
+func (a *AwsProvider) createBucket(name string) error {
+	var config *s3types.CreateBucketConfiguration = nil
+	if a.config.Region != "us-east-1" {
+		config = &s3types.CreateBucketConfiguration{
+			LocationConstraint: s3types.BucketLocationConstraint(a.config.Region),
+		}
+	}
+	_, err := s3.NewFromConfig(a.config).CreateBucket(context.TODO(), &s3.CreateBucketInput{
+		Bucket:                    aws.String(name),
+		CreateBucketConfiguration: config,
+	})
+	return err
+}
+
+// createAssetBucket creates the asset bucket with an empty notification
+// config, so it can be used with EventBridge notifications later.
+func (a *AwsProvider) createAssetBucket(name string) error {
+	err := a.createBucket(name)
+	if err != nil {
+		return err
+	}
+	_, err = s3.NewFromConfig(a.config).PutBucketNotificationConfiguration(context.TODO(), &s3.PutBucketNotificationConfigurationInput{
+		Bucket:                    aws.String(name),
+		NotificationConfiguration: &s3types.NotificationConfiguration{},
+	})
+	return err
+}
+
+func (a *AwsProvider) blockPublicAccess(name string) error {
+	_, err := s3.NewFromConfig(a.config).PutPublicAccessBlock(context.TODO(), &s3.PutPublicAccessBlockInput{
+		Bucket: aws.String(name),
+		PublicAccessBlockConfiguration: &s3types.PublicAccessBlockConfiguration{
+			BlockPublicAcls:       aws.Bool(true),
+			BlockPublicPolicy:     aws.Bool(true),
+			IgnorePublicAcls:      aws.Bool(true),
+			RestrictPublicBuckets: aws.Bool(true),
+		},
+	})
+	return err
+}
+
+func (a *AwsProvider) putBootstrap(data *awsBootstrapData, overwrite bool) error {
+	value, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	input := &ssm.PutParameterInput{
+		Name:      aws.String(SSM_NAME_BOOTSTRAP),
+		Type:      ssmTypes.ParameterTypeString,
+		Value:     aws.String(string(value)),
+		Overwrite: aws.Bool(overwrite),
+	}
+	if !overwrite {
+		for key, value := range a.bootstrapConfig.Tags {
+			input.Tags = append(input.Tags, ssmTypes.Tag{Key: aws.String(key), Value: aws.String(value)})
+		}
+	}
+	_, err = ssm.NewFromConfig(a.config).PutParameter(context.TODO(), input)
+	return err
+}
+
+func formatTags(tags map[string]string) string {
+	result := []string{}
+	for key, value := range tags {
+		result = append(result, key+"="+value)
+	}
+	sort.Strings(result)
+	return strings.Join(result, ", ")
+}
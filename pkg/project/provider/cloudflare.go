@@ -3,11 +3,13 @@ package provider
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	_ "unsafe"
 
 	cloudflare "github.com/cloudflare/cloudflare-go"
@@ -15,10 +17,16 @@ import (
 )
 
 type CloudflareProvider struct {
+	// DeferBootstrap skips creating the state bucket in Init, so it can be
+	// planned and confirmed before calling Bootstrap.
+	DeferBootstrap bool
+
 	client     *cloudflare.API
 	identifier *cloudflare.ResourceContainer
 	env        map[string]string
 	bootstrap  *bootstrap
+	// stateBucket is the name of the R2 bucket the state is stored in
+	stateBucket string
 }
 
 type bootstrap struct {
@@ -30,15 +38,25 @@ func (c *CloudflareProvider) Init(app, stage string, provider map[string]interfa
 	apiToken := os.Getenv("CLOUDFLARE_API_TOKEN")
 	apiKey := os.Getenv("CLOUDFLARE_API_KEY")
 	email := os.Getenv("CLOUDFLARE_EMAIL")
-	if provider["apiToken"] != nil {
-		apiToken = provider["apiToken"].(string)
+	if value := argString(provider["accountId"]); value != "" {
+		accountID = value
+	}
+	if value := argString(provider["apiToken"]); value != "" {
+		apiToken = value
 	}
-	if provider["apiKey"] != nil {
-		apiKey = provider["apiKey"].(string)
+	if value := argString(provider["apiKey"]); value != "" {
+		apiKey = value
 	}
-	if provider["email"] != nil {
-		email = provider["email"].(string)
+	if value := argString(provider["email"]); value != "" {
+		email = value
+	}
+	c.stateBucket = "sst-state"
+	if cfg, ok := provider["bootstrap"].(map[string]interface{}); ok {
+		if value := argString(cfg["stateBucket"]); value != "" {
+			c.stateBucket = value
+		}
 	}
+	delete(provider, "bootstrap")
 	var api *cloudflare.API
 	c.env = map[string]string{}
 	if apiToken != "" {
@@ -59,7 +77,10 @@ func (c *CloudflareProvider) Init(app, stage string, provider map[string]interfa
 		if err != nil {
 			return err
 		}
-		accountID = accounts[0].ID
+		accountID, err = selectAccount(accounts)
+		if err != nil {
+			return err
+		}
 	}
 	c.env["CLOUDFLARE_DEFAULT_ACCOUNT_ID"] = accountID
 	c.identifier = cloudflare.AccountIdentifier(accountID)
@@ -67,13 +88,13 @@ func (c *CloudflareProvider) Init(app, stage string, provider map[string]interfa
 
 	ctx := context.Background()
 	buckets, err := api.ListR2Buckets(ctx, c.identifier, cloudflare.ListR2BucketsParams{
-		Name: "sst-state",
+		Name: c.stateBucket,
 	})
 	if err != nil {
 		return err
 	}
 	for _, bucket := range buckets {
-		if bucket.Name == "sst-state" {
+		if bucket.Name == c.stateBucket {
 			slog.Info("found existing bucket", "bucket", bucket.Name)
 			c.bootstrap = &bootstrap{
 				State: bucket.Name,
@@ -81,19 +102,54 @@ func (c *CloudflareProvider) Init(app, stage string, provider map[string]interfa
 		}
 	}
 
-	if c.bootstrap == nil {
-		slog.Info("creating new bucket", "bucket", "sst-state")
-		_, err = c.client.CreateR2Bucket(ctx, c.identifier, cloudflare.CreateR2BucketParameters{
-			Name: "sst-state",
-		})
-		if err != nil {
-			return err
-		}
-		c.bootstrap = &bootstrap{
-			State: "sst-state",
-		}
+	if !c.DeferBootstrap {
+		return c.Bootstrap()
+	}
+
+	return nil
+}
+
+// selectAccount picks the only account the credentials have access to. With
+// more than one, guessing could put the state in the wrong account.
+func selectAccount(accounts []cloudflare.Account) (string, error) {
+	if len(accounts) == 0 {
+		return "", util.NewReadableError(nil, "The Cloudflare credentials do not have access to any accounts.")
+	}
+	if len(accounts) == 1 {
+		return accounts[0].ID, nil
 	}
+	lines := []string{"The Cloudflare credentials have access to several accounts. Set the accountId in the cloudflare provider config, or the CLOUDFLARE_DEFAULT_ACCOUNT_ID environment variable, to one of:"}
+	for _, account := range accounts {
+		lines = append(lines, fmt.Sprintf("   %v  %v", account.ID, account.Name))
+	}
+	return "", util.NewReadableError(nil, strings.Join(lines, "\n"))
+}
 
+// PlanBootstrap lists the changes Bootstrap would make.
+func (c *CloudflareProvider) PlanBootstrap() ([]string, error) {
+	if c.bootstrap != nil {
+		return []string{}, nil
+	}
+	return []string{
+		fmt.Sprintf("Create the R2 bucket %v in the account %v", c.stateBucket, c.identifier.Identifier),
+	}, nil
+}
+
+// Bootstrap creates the state bucket if it does not exist.
+func (c *CloudflareProvider) Bootstrap() error {
+	if c.bootstrap != nil {
+		return nil
+	}
+	slog.Info("creating new bucket", "bucket", c.stateBucket)
+	_, err := c.client.CreateR2Bucket(context.Background(), c.identifier, cloudflare.CreateR2BucketParameters{
+		Name: c.stateBucket,
+	})
+	if err != nil {
+		return err
+	}
+	c.bootstrap = &bootstrap{
+		State: c.stateBucket,
+	}
 	return nil
 }
 
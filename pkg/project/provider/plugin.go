@@ -0,0 +1,304 @@
+package provider
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sst/ion/internal/util"
+)
+
+// PLUGIN_PROTOCOL_VERSION is sent to home plugins when they are initialized.
+const PLUGIN_PROTOCOL_VERSION = 1
+
+// PluginPrefix selects a home plugin, like "plugin:gcs".
+const PluginPrefix = "plugin:"
+
+// pluginCallTimeout is how long a plugin has to answer a request.
+const pluginCallTimeout = 5 * time.Minute
+
+// pluginCloseTimeout is how long a plugin has to exit after its stdin is
+// closed, before it is killed.
+const pluginCloseTimeout = 5 * time.Second
+
+// PluginProvider is a home that is implemented by a separate executable. The
+// executable for the plugin "gcs" is called sst-home-gcs, and is looked up in
+// the node_modules/.bin of the app and then in the PATH.
+//
+// The CLI talks to it with JSON-RPC 2.0 over stdio, one message per line. The
+// methods are initialize, getData, putData, removeData, listData,
+// getPassphrase and setPassphrase. Data is sent base64 encoded, and missing
+// data is null. The plugin should exit when its stdin is closed.
+type PluginProvider struct {
+	Name string
+	// Dir is the root of the app
+	Dir string
+	// Timeout is how long a request can take, it defaults to 5 minutes
+	Timeout time.Duration
+
+	lock      sync.Mutex
+	cmd       *exec.Cmd
+	stdin     io.WriteCloser
+	responses chan pluginResponse
+	readErr   error
+	counter   int
+	env       map[string]string
+	closeOnce sync.Once
+	closeErr  error
+}
+
+type pluginRequest struct {
+	JSONRPC string      `json:"jsonrpc"`
+	ID      int         `json:"id"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+type pluginResponse struct {
+	ID     int             `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+type pluginDataParams struct {
+	Key   string  `json:"key"`
+	App   string  `json:"app"`
+	Stage string  `json:"stage"`
+	Data  *string `json:"data,omitempty"`
+}
+
+type pluginListParams struct {
+	Key string `json:"key"`
+	App string `json:"app"`
+}
+
+type pluginPassphraseParams struct {
+	App        string `json:"app"`
+	Stage      string `json:"stage"`
+	Passphrase string `json:"passphrase,omitempty"`
+}
+
+func (p *PluginProvider) executable() (string, error) {
+	name := "sst-home-" + p.Name
+	local := filepath.Join(p.Dir, "node_modules", ".bin", name)
+	if _, err := os.Stat(local); err == nil {
+		return local, nil
+	}
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return "", util.NewReadableError(err, fmt.Sprintf("Could not find the home plugin \"%s\". Install it in your app or add %s to your PATH.", p.Name, name))
+	}
+	return path, nil
+}
+
+func (p *PluginProvider) Init(app, stage string, args map[string]interface{}) error {
+	path, err := p.executable()
+	if err != nil {
+		return err
+	}
+	slog.Info("starting home plugin", "name", p.Name, "path", path)
+	p.cmd = exec.Command(path)
+	p.cmd.Dir = p.Dir
+	p.cmd.Stderr = os.Stderr
+	p.stdin, err = p.cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := p.cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	err = p.cmd.Start()
+	if err != nil {
+		return err
+	}
+	p.responses = make(chan pluginResponse, 16)
+	go p.read(stdout)
+
+	var result struct {
+		Env map[string]string `json:"env"`
+	}
+	err = p.call("initialize", map[string]interface{}{
+		"version": PLUGIN_PROTOCOL_VERSION,
+		"app":     app,
+		"stage":   stage,
+		"args":    args,
+	}, &result)
+	if err != nil {
+		p.Close()
+		return err
+	}
+	p.env = result.Env
+	if p.env == nil {
+		p.env = map[string]string{}
+	}
+	return nil
+}
+
+// read passes the responses of the plugin to call, anything else it writes to
+// stdout is treated as a log line.
+func (p *PluginProvider) read(stdout io.Reader) {
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 1024*1024), 1024*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var response pluginResponse
+		err := json.Unmarshal(line, &response)
+		if err != nil {
+			slog.Info("home plugin", "name", p.Name, "line", string(line))
+			continue
+		}
+		p.responses <- response
+	}
+	p.readErr = scanner.Err()
+	close(p.responses)
+}
+
+// Close closes the stdin of the plugin and waits for it to exit, it is killed
+// if it does not exit in time.
+func (p *PluginProvider) Close() error {
+	p.closeOnce.Do(func() {
+		if p.cmd == nil || p.cmd.Process == nil {
+			return
+		}
+		p.stdin.Close()
+		done := make(chan error, 1)
+		go func() { done <- p.cmd.Wait() }()
+		select {
+		case p.closeErr = <-done:
+		case <-time.After(pluginCloseTimeout):
+			slog.Info("killing home plugin", "name", p.Name)
+			p.cmd.Process.Kill()
+			<-done
+			p.closeErr = fmt.Errorf("home plugin %s did not exit and was killed", p.Name)
+		}
+	})
+	return p.closeErr
+}
+
+// call sends a request and waits for its response. Requests are sent one at a
+// time, so plugins do not need to handle them concurrently.
+func (p *PluginProvider) call(method string, params interface{}, out interface{}) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.counter++
+	data, err := json.Marshal(pluginRequest{
+		JSONRPC: "2.0",
+		ID:      p.counter,
+		Method:  method,
+		Params:  params,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = p.stdin.Write(append(data, '\n'))
+	if err != nil {
+		return fmt.Errorf("home plugin %s: %w", p.Name, err)
+	}
+	timeout := p.Timeout
+	if timeout == 0 {
+		timeout = pluginCallTimeout
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case response, ok := <-p.responses:
+			if !ok {
+				if p.readErr != nil {
+					return fmt.Errorf("home plugin %s: %w", p.Name, p.readErr)
+				}
+				return fmt.Errorf("home plugin %s exited while handling %s", p.Name, method)
+			}
+			// responses to requests that timed out are skipped
+			if response.ID != p.counter {
+				continue
+			}
+			if response.Error != nil {
+				return fmt.Errorf("home plugin %s: %s", p.Name, response.Error.Message)
+			}
+			if out == nil || len(response.Result) == 0 {
+				return nil
+			}
+			return json.Unmarshal(response.Result, out)
+		case <-timer.C:
+			return fmt.Errorf("home plugin %s did not answer %s within %v", p.Name, method, timeout)
+		}
+	}
+}
+
+func (p *PluginProvider) Env() (map[string]string, error) {
+	return p.env, nil
+}
+
+func (p *PluginProvider) getData(key, app, stage string) (io.Reader, error) {
+	var result struct {
+		Data *string `json:"data"`
+	}
+	err := p.call("getData", pluginDataParams{Key: key, App: app, Stage: stage}, &result)
+	if err != nil {
+		return nil, err
+	}
+	if result.Data == nil {
+		return nil, nil
+	}
+	data, err := base64.StdEncoding.DecodeString(*result.Data)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(data), nil
+}
+
+func (p *PluginProvider) putData(key, app, stage string, data io.Reader) error {
+	read, err := io.ReadAll(data)
+	if err != nil {
+		return err
+	}
+	encoded := base64.StdEncoding.EncodeToString(read)
+	return p.call("putData", pluginDataParams{Key: key, App: app, Stage: stage, Data: &encoded}, nil)
+}
+
+func (p *PluginProvider) removeData(key, app, stage string) error {
+	return p.call("removeData", pluginDataParams{Key: key, App: app, Stage: stage}, nil)
+}
+
+func (p *PluginProvider) listData(key, app string) ([]string, error) {
+	var result struct {
+		Stages []string `json:"stages"`
+	}
+	err := p.call("listData", pluginListParams{Key: key, App: app}, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result.Stages, nil
+}
+
+func (p *PluginProvider) setPassphrase(app, stage, passphrase string) error {
+	return p.call("setPassphrase", pluginPassphraseParams{App: app, Stage: stage, Passphrase: passphrase}, nil)
+}
+
+func (p *PluginProvider) getPassphrase(app, stage string) (string, error) {
+	var result struct {
+		Passphrase string `json:"passphrase"`
+	}
+	err := p.call("getPassphrase", pluginPassphraseParams{App: app, Stage: stage}, &result)
+	if err != nil {
+		return "", err
+	}
+	return result.Passphrase, nil
+}
@@ -0,0 +1,191 @@
+package provider
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestHelperPlugin is not a real test, it is the home plugin started by the
+// other plugin tests.
+func TestHelperPlugin(t *testing.T) {
+	if os.Getenv("SST_TEST_HELPER_PLUGIN") != "1" {
+		return
+	}
+	data := map[string]string{}
+	passphrases := map[string]string{}
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		var request struct {
+			ID     int               `json:"id"`
+			Method string            `json:"method"`
+			Params map[string]string `json:"params"`
+		}
+		json.Unmarshal(scanner.Bytes(), &request)
+		params := request.Params
+		path := params["app"] + "/" + params["stage"] + "/" + params["key"]
+		var result interface{}
+		switch request.Method {
+		case "initialize":
+			fmt.Println("starting up")
+			result = map[string]interface{}{"env": map[string]string{"PLUGIN": "1"}}
+		case "getData":
+			value, ok := data[path]
+			if !ok {
+				result = map[string]interface{}{"data": nil}
+				break
+			}
+			result = map[string]interface{}{"data": value}
+		case "putData":
+			data[path] = params["data"]
+		case "removeData":
+			delete(data, path)
+		case "listData":
+			prefix := params["app"] + "/"
+			stages := []string{}
+			for item := range data {
+				parts := strings.Split(strings.TrimPrefix(item, prefix), "/")
+				if strings.HasPrefix(item, prefix) && len(parts) == 2 && parts[1] == params["key"] {
+					stages = append(stages, parts[0])
+				}
+			}
+			sort.Strings(stages)
+			result = map[string]interface{}{"stages": stages}
+		case "hang":
+			continue
+		case "getPassphrase":
+			result = map[string]string{"passphrase": passphrases[params["app"]+"/"+params["stage"]]}
+		case "setPassphrase":
+			passphrases[params["app"]+"/"+params["stage"]] = params["passphrase"]
+		default:
+			out, _ := json.Marshal(map[string]interface{}{
+				"jsonrpc": "2.0",
+				"id":      request.ID,
+				"error":   map[string]interface{}{"code": -32601, "message": "method not found"},
+			})
+			fmt.Println(string(out))
+			continue
+		}
+		out, _ := json.Marshal(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      request.ID,
+			"result":  result,
+		})
+		fmt.Println(string(out))
+	}
+	os.Exit(0)
+}
+
+func startHelperPlugin(t *testing.T) *PluginProvider {
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "node_modules", ".bin")
+	if err := os.MkdirAll(bin, 0755); err != nil {
+		t.Fatal(err)
+	}
+	script := fmt.Sprintf("#!/bin/sh\nSST_TEST_HELPER_PLUGIN=1 exec %s -test.run=TestHelperPlugin\n", os.Args[0])
+	if err := os.WriteFile(filepath.Join(bin, "sst-home-test"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	p := &PluginProvider{Name: "test", Dir: dir}
+	if err := p.Init("app", "dev", map[string]interface{}{}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { p.Close() })
+	return p
+}
+
+func TestPluginProvider(t *testing.T) {
+	p := startHelperPlugin(t)
+	env, _ := p.Env()
+	if env["PLUGIN"] != "1" {
+		t.Fatalf("env = %v", env)
+	}
+
+	result, err := p.getData("state", "app", "dev")
+	if err != nil || result != nil {
+		t.Fatalf("missing data = %v, %v", result, err)
+	}
+	if err := p.putData("state", "app", "dev", strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+	result, err = p.getData("state", "app", "dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	read, _ := io.ReadAll(result)
+	if string(read) != "hello" {
+		t.Fatalf("data = %q", read)
+	}
+	if err := p.removeData("state", "app", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	result, _ = p.getData("state", "app", "dev")
+	if result != nil {
+		t.Fatal("data was not removed")
+	}
+
+	if err := p.setPassphrase("app", "dev", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	passphrase, err := p.getPassphrase("app", "dev")
+	if err != nil || passphrase != "secret" {
+		t.Fatalf("passphrase = %q, %v", passphrase, err)
+	}
+
+	if err := p.call("unknown", map[string]string{}, nil); err == nil {
+		t.Fatal("expected an error for an unknown method")
+	}
+}
+
+func TestPluginProviderListStages(t *testing.T) {
+	p := startHelperPlugin(t)
+	for _, stage := range []string{"production", "dev"} {
+		if err := p.putData("app", "app", stage, strings.NewReader("{}")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.putData("secret", "app", "other", strings.NewReader("{}")); err != nil {
+		t.Fatal(err)
+	}
+	stages, err := ListStages(p, "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(stages, ",") != "dev,production" {
+		t.Fatalf("stages = %v", stages)
+	}
+}
+
+func TestPluginProviderTimeout(t *testing.T) {
+	p := startHelperPlugin(t)
+	p.Timeout = 100 * time.Millisecond
+	err := p.call("hang", map[string]string{}, nil)
+	if err == nil || !strings.Contains(err.Error(), "did not answer") {
+		t.Fatalf("err = %v", err)
+	}
+	// the plugin still answers the requests after the one that timed out
+	if _, err := p.getPassphrase("app", "dev"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPluginProviderClose(t *testing.T) {
+	p := startHelperPlugin(t)
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if p.cmd.ProcessState == nil || !p.cmd.ProcessState.Exited() {
+		t.Fatal("the plugin did not exit")
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
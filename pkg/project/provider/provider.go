@@ -26,6 +26,36 @@ type Home interface {
 	getPassphrase(app, stage string) (string, error)
 }
 
+// Lister is a home that can list the stages it has data for.
+type Lister interface {
+	Home
+	listData(key, app string) ([]string, error)
+}
+
+// Bootstrapper is a home that creates the resources it stores state in. A
+// missing bootstrap is created in Init, unless it is deferred so it can be
+// planned and confirmed first. An outdated one is only migrated by Bootstrap.
+type Bootstrapper interface {
+	Home
+	// PlanBootstrap lists the changes Bootstrap would make, it is empty when
+	// the bootstrap is up to date.
+	PlanBootstrap() ([]string, error)
+	Bootstrap() error
+}
+
+// argString reads a string arg, unwrapping values marked with $secret.
+func argString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case map[string]interface{}:
+		if len(v) == 1 {
+			return argString(v["__secret"])
+		}
+	}
+	return ""
+}
+
 type DevTransport struct {
 	In  chan string
 	Out chan string
@@ -130,6 +160,31 @@ func PutSecrets(backend Home, app, stage string, data map[string]string) error {
 	return putData(backend, "secret", app, stage, true, data)
 }
 
+func GetHistory(backend Home, app, stage string) ([]json.RawMessage, error) {
+	data := []json.RawMessage{}
+	err := getData(backend, "history", app, stage, true, &data)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// AppendHistory adds an entry to the end of the history of a stage. It should
+// only be called while holding the lock.
+func AppendHistory(backend Home, app, stage string, entry interface{}) error {
+	slog.Info("appending history", "app", app, "stage", stage)
+	history, err := GetHistory(backend, app, stage)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	history = append(history, data)
+	return putData(backend, "history", app, stage, true, history)
+}
+
 func PushState(backend Home, app, stage string, from string) error {
 	slog.Info("pushing state", "app", app, "stage", stage, "from", from)
 	file, err := os.Open(from)
@@ -139,6 +194,15 @@ func PushState(backend Home, app, stage string, from string) error {
 	return backend.putData("app", app, stage, file)
 }
 
+// ListStages lists the stages of an app that have state in the home.
+func ListStages(backend Home, app string) ([]string, error) {
+	lister, ok := backend.(Lister)
+	if !ok {
+		return nil, fmt.Errorf("this home cannot list the stages of an app")
+	}
+	return lister.listData("app", app)
+}
+
 var ErrStateNotFound = fmt.Errorf("state not found")
 
 func PullState(backend Home, app, stage string, out string) error {
@@ -162,6 +226,18 @@ func PullState(backend Home, app, stage string, out string) error {
 	return nil
 }
 
+// StageExists checks if the stage has any state in the home.
+func StageExists(backend Home, app, stage string) (bool, error) {
+	reader, err := backend.getData("app", app, stage)
+	if err != nil {
+		return false, err
+	}
+	if closer, ok := reader.(io.Closer); ok {
+		closer.Close()
+	}
+	return reader != nil, nil
+}
+
 type lockData struct {
 	Created time.Time `json:"created"`
 }
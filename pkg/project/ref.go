@@ -0,0 +1,205 @@
+package project
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	esbuild "github.com/evanw/esbuild/pkg/api"
+
+	"github.com/sst/ion/internal/util"
+	"github.com/sst/ion/pkg/project/provider"
+)
+
+// refCall finds every call to $ref, and refPattern has to match each of them
+// for $ref("app"), $ref("app", "stage"), or $ref("app", $app.stage). Refs are
+// resolved before the program runs, so the arguments have to be known from
+// the source.
+var refCall = regexp.MustCompile(`\$ref\(`)
+var refPattern = regexp.MustCompile(`^\$ref\(\s*["'` + "`" + `]([^"'` + "`" + `$]+)["'` + "`" + `]\s*(?:,\s*(?:["'` + "`" + `]([^"'` + "`" + `$]+)["'` + "`" + `]|(\$app\.stage))\s*)?\)`)
+
+type ref struct {
+	App string
+	// Stage is empty if it is the current stage
+	Stage string
+}
+
+// maskSource blanks out comments and the text of strings, keeping the offsets
+// and line breaks, so only the calls to $ref in the code are found.
+func maskSource(source string) string {
+	out := []byte(source)
+	blank := func(i int) {
+		if out[i] != '\n' {
+			out[i] = ' '
+		}
+	}
+	// templates holds the brace depth of each template literal that is being
+	// interpolated
+	templates := []int{}
+	depth := 0
+	for i := 0; i < len(source); i++ {
+		c := source[i]
+		switch {
+		case strings.HasPrefix(source[i:], "//"):
+			for ; i < len(source) && source[i] != '\n'; i++ {
+				blank(i)
+			}
+		case strings.HasPrefix(source[i:], "/*"):
+			end := strings.Index(source[i+2:], "*/")
+			stop := len(source)
+			if end >= 0 {
+				stop = i + 2 + end + 2
+			}
+			for ; i < stop; i++ {
+				blank(i)
+			}
+			i--
+		case c == '"' || c == '\'':
+			for i++; i < len(source) && source[i] != c && source[i] != '\n'; i++ {
+				if source[i] == '\\' && i+1 < len(source) {
+					blank(i)
+					i++
+				}
+				blank(i)
+			}
+		case c == '`' || (c == '}' && len(templates) > 0 && templates[len(templates)-1] == depth):
+			if c == '}' {
+				templates = templates[:len(templates)-1]
+			}
+			for i++; i < len(source) && source[i] != '`'; i++ {
+				if strings.HasPrefix(source[i:], "${") {
+					templates = append(templates, depth)
+					i++
+					break
+				}
+				if source[i] == '\\' && i+1 < len(source) {
+					blank(i)
+					i++
+				}
+				blank(i)
+			}
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+		}
+	}
+	return string(out)
+}
+
+func parseRefs(source string) ([]ref, error) {
+	seen := map[ref]bool{}
+	result := []ref{}
+	for _, loc := range refCall.FindAllStringIndex(maskSource(source), -1) {
+		match := refPattern.FindStringSubmatch(source[loc[0]:])
+		if match == nil {
+			line := strings.Count(source[:loc[0]], "\n") + 1
+			return nil, fmt.Errorf("line %d: $ref has to be called with a string for the app, and a string or $app.stage for the stage", line)
+		}
+		item := ref{App: match[1], Stage: match[2]}
+		if !seen[item] {
+			seen[item] = true
+			result = append(result, item)
+		}
+	}
+	return result, nil
+}
+
+// configSources returns the config and the files in the app it imports, so
+// refs in them are found too. If the config cannot be bundled, only the
+// config is returned and the build reports the error.
+func configSources(cfgPath string) []string {
+	dir := filepath.Dir(cfgPath)
+	result := esbuild.Build(esbuild.BuildOptions{
+		EntryPoints:   []string{cfgPath},
+		AbsWorkingDir: dir,
+		Bundle:        true,
+		Write:         false,
+		Metafile:      true,
+		Format:        esbuild.FormatESModule,
+		Platform:      esbuild.PlatformNode,
+		Packages:      esbuild.PackagesExternal,
+		LogLevel:      esbuild.LogLevelSilent,
+	})
+	if len(result.Errors) > 0 {
+		slog.Info("could not find config imports", "errors", result.Errors)
+		return []string{cfgPath}
+	}
+	var meta struct {
+		Inputs map[string]interface{} `json:"inputs"`
+	}
+	if err := json.Unmarshal([]byte(result.Metafile), &meta); err != nil {
+		return []string{cfgPath}
+	}
+	files := []string{}
+	for input := range meta.Inputs {
+		file := filepath.Join(dir, input)
+		if strings.Contains(input, "node_modules") || file == filepath.Clean(cfgPath) {
+			continue
+		}
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	return append([]string{cfgPath}, files...)
+}
+
+// configRefs returns the refs in the config and the files it imports.
+func configRefs(cfgPath string) ([]ref, error) {
+	seen := map[ref]bool{}
+	result := []ref{}
+	for _, file := range configSources(cfgPath) {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		refs, err := parseRefs(string(data))
+		if err != nil {
+			return nil, util.NewReadableError(err, fmt.Sprintf("%s %s", RelativeConfig(file), err))
+		}
+		for _, item := range refs {
+			if !seen[item] {
+				seen[item] = true
+				result = append(result, item)
+			}
+		}
+	}
+	return result, nil
+}
+
+// resolveRefs fetches the links of every app and stage referenced with $ref
+// in the config and the files it imports, keyed by app/stage.
+func (p *Project) resolveRefs() (map[string]interface{}, error) {
+	refs, err := configRefs(p.config)
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]interface{}{}
+	for _, item := range refs {
+		stage := item.Stage
+		if stage == "" {
+			stage = p.app.Stage
+		}
+		key := item.App + "/" + stage
+		if _, ok := result[key]; ok {
+			continue
+		}
+		exists, err := provider.StageExists(p.home, item.App, stage)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, util.NewReadableError(nil, fmt.Sprintf("The stage \"%s\" of the app \"%s\" referenced with $ref does not exist. Deploy it first.", stage, item.App))
+		}
+		links, err := provider.GetLinks(p.home, item.App, stage)
+		if err != nil {
+			return nil, err
+		}
+		result[key] = links
+	}
+	return result, nil
+}
@@ -0,0 +1,97 @@
+package project
+
+import (
+	"regexp"
+	"time"
+)
+
+type RetryConfig struct {
+	// Attempts is the max number of times to run a deploy, including the
+	// first one
+	Attempts *int `json:"attempts"`
+	// Patterns are regular expressions for errors that are safe to retry, on
+	// top of DefaultRetryPatterns
+	Patterns []string `json:"patterns"`
+}
+
+type RetryEvent struct {
+	Attempt int
+	Max     int
+	Delay   time.Duration
+	Errors  []Error
+}
+
+// DefaultRetryPatterns match throttling and eventual consistency errors that
+// usually go away if the deploy is run again.
+var DefaultRetryPatterns = []string{
+	`TooManyRequestsException`,
+	`Throttling(Exception)?`,
+	`Rate exceeded`,
+	`RequestLimitExceeded`,
+	`SlowDown`,
+	`ConcurrentModificationException`,
+	`OperationAbortedException`,
+	`ResourceConflictException`,
+	`The role defined for the function cannot be assumed by Lambda`,
+	`execution role does not have permissions`,
+	`is not authorized to perform: sts:AssumeRole`,
+	`InvalidParameterValueException: .*role`,
+	`connection reset by peer`,
+	`i/o timeout`,
+}
+
+const defaultRetryAttempts = 3
+
+var retryBackoff = 5 * time.Second
+
+type retrier struct {
+	max      int
+	patterns []*regexp.Regexp
+}
+
+func (p *Project) retrier() (*retrier, error) {
+	result := &retrier{
+		max: defaultRetryAttempts,
+	}
+	patterns := DefaultRetryPatterns
+	if cfg := p.app.Retry; cfg != nil {
+		if cfg.Attempts != nil {
+			result.max = max(*cfg.Attempts, 1)
+		}
+		patterns = append(append([]string{}, patterns...), cfg.Patterns...)
+	}
+	for _, pattern := range patterns {
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		result.patterns = append(result.patterns, compiled)
+	}
+	return result, nil
+}
+
+// retryable checks if every error matches one of the patterns. If any of them
+// does not, running the deploy again would fail the same way.
+func (r *retrier) retryable(errors []Error) bool {
+	if len(errors) == 0 {
+		return false
+	}
+	for _, item := range errors {
+		matched := false
+		for _, pattern := range r.patterns {
+			if pattern.MatchString(item.Message) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// delay doubles the backoff after every attempt.
+func (r *retrier) delay(attempt int) time.Duration {
+	return retryBackoff * time.Duration(1<<(attempt-1))
+}
@@ -0,0 +1,23 @@
+package project
+
+import "testing"
+
+func TestRetryable(t *testing.T) {
+	p := &Project{app: &App{Retry: &RetryConfig{Patterns: []string{`ServiceUnavailable`}}}}
+	r, err := p.retrier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	throttled := Error{Message: "creating Lambda Function: TooManyRequestsException: Rate exceeded"}
+	custom := Error{Message: "ServiceUnavailable: try again"}
+	invalid := Error{Message: "InvalidBucketName: the bucket name is not valid"}
+	if !r.retryable([]Error{throttled, custom}) {
+		t.Errorf("expected throttling and custom errors to be retryable")
+	}
+	if r.retryable([]Error{throttled, invalid}) {
+		t.Errorf("expected a non-transient error to not be retried")
+	}
+	if r.retryable([]Error{}) {
+		t.Errorf("expected no errors to not be retried")
+	}
+}
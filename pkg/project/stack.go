@@ -9,16 +9,19 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/pulumi/pulumi/sdk/v3/go/auto"
 	"github.com/pulumi/pulumi/sdk/v3/go/auto/events"
 	"github.com/pulumi/pulumi/sdk/v3/go/auto/optdestroy"
+	"github.com/pulumi/pulumi/sdk/v3/go/auto/optpreview"
 	"github.com/pulumi/pulumi/sdk/v3/go/auto/optrefresh"
 	"github.com/pulumi/pulumi/sdk/v3/go/auto/optup"
 	"github.com/pulumi/pulumi/sdk/v3/go/common/apitype"
 	"github.com/pulumi/pulumi/sdk/v3/go/common/resource"
 	"github.com/pulumi/pulumi/sdk/v3/go/common/tokens"
 	"github.com/pulumi/pulumi/sdk/v3/go/common/workspace"
+	"github.com/sst/ion/internal/util"
 	"github.com/sst/ion/pkg/global"
 	"github.com/sst/ion/pkg/js"
 	"github.com/sst/ion/pkg/project/provider"
@@ -34,13 +37,36 @@ type StackEvent struct {
 	ConcurrentUpdateEvent *ConcurrentUpdateEvent
 	CompleteEvent         *CompleteEvent
 	StackCommandEvent     *StackCommandEvent
+	HookEvent             *HookEvent
+	RetryEvent            *RetryEvent
 }
 
 type StackInput struct {
 	OnEvent func(event *StackEvent)
 	OnFiles func(files []string)
-	Command string
-	Dev     bool
+	// Confirm is called with the protected resources that will be replaced
+	// or deleted. The deploy is cancelled if it returns false.
+	Confirm func(changes []DestructiveChange) bool
+	// Interrupted is closed when the user asks to stop, no more retries are
+	// started after that
+	Interrupted <-chan struct{}
+	Command     string
+	Dev         bool
+}
+
+func (input *StackInput) interrupted() bool {
+	select {
+	case <-input.Interrupted:
+		return true
+	default:
+		return false
+	}
+}
+
+type DestructiveChange struct {
+	URN  string
+	Type string
+	Op   apitype.OpType
 }
 
 type StdOutEvent struct {
@@ -77,6 +103,8 @@ type CompleteEvent struct {
 	Errors    []Error
 	Finished  bool
 	Resources []apitype.ResourceV3
+	// Retained are the resources left behind by a remove
+	Retained []apitype.ResourceV3
 }
 
 type StackCommandEvent struct {
@@ -91,34 +119,112 @@ type Error struct {
 type StackEventStream = chan StackEvent
 
 var ErrStackRunFailed = fmt.Errorf("stack run had errors")
+var ErrStackCancelled = fmt.Errorf("stack run cancelled")
 var ErrStageNotFound = fmt.Errorf("stage not found")
+var ErrStateNotPushed = fmt.Errorf("state not pushed")
 
-func (s *stack) Run(ctx context.Context, input *StackInput) error {
+func (s *stack) Run(ctx context.Context, input *StackInput) (err error) {
 	slog.Info("running stack command", "cmd", input.Command)
+	started := time.Now()
 	input.OnEvent(&StackEvent{StackCommandEvent: &StackCommandEvent{
 		Command: input.Command,
 	}})
 
-	err := s.Lock()
+	complete := &CompleteEvent{
+		Links:     Links{},
+		Receivers: Receivers{},
+		Warps:     Warps{},
+		Hints:     map[string]string{},
+		Outputs:   map[string]interface{}{},
+		Errors:    []Error{},
+		Finished:  false,
+		Retained:  []apitype.ResourceV3{},
+	}
+	changes := map[string]int{}
+
+	git, gitErr := gitInfo(s.project.PathRoot())
+
+	// commands that fail before they run are recorded and notified too,
+	// unless another command holds the lock or the stage does not exist.
+	record := !input.Dev
+	failed := func() {
+		if err != nil && len(complete.Errors) == 0 {
+			complete.Errors = append(complete.Errors, Error{Message: err.Error()})
+		}
+	}
+	// this is deferred first so slow webhooks run after the state is pushed
+	// and the stage is unlocked
+	defer func() {
+		if !record {
+			return
+		}
+		failed()
+		s.notifyComplete(input.Command, started, git, complete)
+	}()
+
+	if input.Command == "up" {
+		err := s.project.checkGit(git, gitErr)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = s.Lock()
 	if err != nil {
 		if err == provider.ErrLockExists {
+			record = false
 			input.OnEvent(&StackEvent{ConcurrentUpdateEvent: &ConcurrentUpdateEvent{}})
 		}
 		return err
 	}
-	defer s.Unlock()
+	defer func() {
+		// after a force exit the state in the home is stale, so keep the lock
+		// until it is recovered
+		if ctx.Err() != nil && !input.Dev {
+			return
+		}
+		s.Unlock()
+	}()
+	// the history is read and written back, so it is only appended while
+	// holding the lock
+	defer func() {
+		if !record {
+			return
+		}
+		failed()
+		s.recordHistory(input.Command, started, git, changes, complete)
+	}()
 
 	_, err = s.PullState()
 	if err != nil {
 		if errors.Is(err, provider.ErrStateNotFound) {
 			if input.Command != "up" {
+				record = false
 				return ErrStageNotFound
 			}
 		} else {
 			return err
 		}
 	}
-	defer s.PushState()
+	defer func() {
+		if ctx.Err() == nil || input.Dev {
+			pushErr := s.PushState()
+			if pushErr == nil {
+				return
+			}
+			slog.Error("failed to push state", "err", pushErr)
+		}
+		path, recoveryErr := s.SaveRecovery()
+		if recoveryErr != nil {
+			slog.Error("failed to save recovery state", "err", recoveryErr)
+			return
+		}
+		reason := "The state could not be pushed"
+		if ctx.Err() != nil {
+			reason = "Force exited before the state was pushed"
+		}
+		err = util.NewReadableError(ErrStateNotPushed, fmt.Sprintf("%s, a copy was saved to %s\n   To recover, run `sst unlock` and then `sst state push %s`", reason, path, path))
+	}()
 
 	passphrase, err := provider.Passphrase(s.project.home, s.project.app.Name, s.project.app.Stage)
 	if err != nil {
@@ -130,16 +236,22 @@ func (s *stack) Run(ctx context.Context, input *StackInput) error {
 		return fmt.Errorf("failed to list secrets: %w", err)
 	}
 
-	env, err := s.project.home.Env()
-	if err != nil {
-		return err
-	}
+	env := map[string]string{}
 	for _, value := range os.Environ() {
 		pair := strings.SplitN(value, "=", 2)
 		if len(pair) == 2 {
 			env[pair[0]] = pair[1]
 		}
 	}
+	// the provider env is applied last, so the credentials and region sst
+	// resolved are not overwritten by the ones in the shell
+	providerEnv, err := s.project.providerEnv()
+	if err != nil {
+		return err
+	}
+	for key, value := range providerEnv {
+		env[key] = value
+	}
 
 	// env := map[string]string{}
 	for key, value := range secrets {
@@ -147,13 +259,21 @@ func (s *stack) Run(ctx context.Context, input *StackInput) error {
 	}
 	env["PULUMI_CONFIG_PASSPHRASE"] = passphrase
 
+	if !input.Dev {
+		err = s.runHook(input, false, env, nil)
+		if err != nil {
+			return util.NewReadableError(err, err.Error())
+		}
+	}
+
 	cli := map[string]interface{}{
 		"command": input.Command,
 		"dev":     input.Dev,
+		"git":     git,
 		"paths": map[string]string{
 			"home":     global.ConfigDir(),
 			"root":     s.project.PathRoot(),
-			"work":     s.project.PathWorkingDir(),
+			"work":     s.project.PathStageDir(),
 			"platform": s.project.PathPlatformDir(),
 		},
 		"env": env,
@@ -166,6 +286,19 @@ func (s *stack) Run(ctx context.Context, input *StackInput) error {
 	if err != nil {
 		return err
 	}
+	// the program only runs on deploy, so remove and refresh work even if a
+	// referenced stage was already removed
+	refs := map[string]interface{}{}
+	if input.Command == "up" {
+		refs, err = s.project.resolveRefs()
+		if err != nil {
+			return err
+		}
+	}
+	refsBytes, err := json.Marshal(refs)
+	if err != nil {
+		return err
+	}
 
 	providerShim := []string{}
 	for name := range s.project.app.Providers {
@@ -178,9 +311,10 @@ func (s *stack) Run(ctx context.Context, input *StackInput) error {
 	buildResult, err := js.Build(js.EvalOptions{
 		Dir: s.project.PathPlatformDir(),
 		Define: map[string]string{
-			"$app": string(appBytes),
-			"$cli": string(cliBytes),
-			"$dev": fmt.Sprintf("%v", input.Dev),
+			"$app":  string(appBytes),
+			"$cli":  string(cliBytes),
+			"$dev":  fmt.Sprintf("%v", input.Dev),
+			"$refs": string(refsBytes),
 		},
 		Inject: []string{filepath.Join(s.project.PathWorkingDir(), "platform/src/shim/run.js")},
 		Code: fmt.Sprintf(`
@@ -219,13 +353,13 @@ func (s *stack) Run(ctx context.Context, input *StackInput) error {
 	slog.Info("tracked files")
 
 	ws, err := auto.NewLocalWorkspace(ctx,
-		auto.WorkDir(s.project.PathWorkingDir()),
+		auto.WorkDir(s.project.PathStageDir()),
 		auto.PulumiHome(global.ConfigDir()),
 		auto.Project(workspace.Project{
 			Name:    tokens.PackageName(s.project.app.Name),
 			Runtime: workspace.NewProjectRuntimeInfo("nodejs", nil),
 			Backend: &workspace.ProjectBackend{
-				URL: fmt.Sprintf("file://%v", s.project.PathWorkingDir()),
+				URL: fmt.Sprintf("file://%v", s.project.PathStageDir()),
 			},
 			Main: outfile,
 		}),
@@ -247,85 +381,161 @@ func (s *stack) Run(ctx context.Context, input *StackInput) error {
 	}
 	slog.Info("built stack")
 
-	config := auto.ConfigMap{}
-	for provider, args := range s.project.app.Providers {
-		for key, value := range args.(map[string]interface{}) {
-			if provider == "cloudflare" && key == "accountId" {
-				continue
+	err = s.setProviderConfig(ctx, stack)
+	if err != nil {
+		return err
+	}
+	slog.Info("built config")
+
+	// dev redeploys on every change, so policies are only checked on deploy
+	var policies *policies
+	if input.Command == "up" && !input.Dev {
+		policies, err = s.project.loadPolicies()
+		if err != nil {
+			return util.NewReadableError(err, err.Error())
+		}
+	}
+
+	// only resources that already exist can be replaced or deleted, so the
+	// extra preview is skipped when none of them are protected
+	confirm := input.Confirm
+	if input.Command == "up" && confirm != nil {
+		protected, err := s.hasProtected(ctx, stack)
+		if err != nil {
+			return err
+		}
+		if !protected {
+			confirm = nil
+		}
+	}
+
+	if input.Command == "up" && (confirm != nil || policies != nil) {
+		planned, changes, previewErrors, err := s.preview(ctx, stack)
+		if err != nil {
+			// without a preview the protected resources cannot be checked, so
+			// nothing is deployed
+			slog.Error("preview failed", "err", err)
+			if len(previewErrors) == 0 {
+				previewErrors = []Error{{Message: err.Error()}}
 			}
-			switch v := value.(type) {
-			case string:
-				config[fmt.Sprintf("%v:%v", provider, key)] = auto.ConfigValue{Value: v}
-			case []string:
-				for i, val := range v {
-					config[fmt.Sprintf("%v:%v[%d]", provider, key, i)] = auto.ConfigValue{Value: val}
-				}
+			complete.Errors = previewErrors
+			input.OnEvent(&StackEvent{CompleteEvent: complete})
+			return ErrStackRunFailed
+		}
+		if policies != nil {
+			violations, err := policies.check(s.project, planned)
+			if err != nil {
+				return util.NewReadableError(err, err.Error())
+			}
+			if len(violations) > 0 {
+				complete.Errors = violations
+				input.OnEvent(&StackEvent{CompleteEvent: complete})
+				return ErrStackRunFailed
 			}
 		}
+		if confirm != nil && len(changes) > 0 && !confirm(changes) {
+			// the user cancelled, so nothing ran that should be recorded
+			record = false
+			return ErrStackCancelled
+		}
 	}
-	err = stack.SetAllConfig(ctx, config)
+
+	retained := []apitype.ResourceV3{}
+	if input.Command == "destroy" {
+		export, err := stack.Export(ctx)
+		if err != nil {
+			return err
+		}
+		var deployment apitype.DeploymentV3
+		err = json.Unmarshal(export.Deployment, &deployment)
+		if err != nil {
+			return err
+		}
+		_, retained = PartitionRetained(deployment.Resources)
+	}
+
+	retrier, err := s.project.retrier()
 	if err != nil {
-		return err
+		return util.NewReadableError(err, "Invalid retry pattern: "+err.Error())
 	}
-	slog.Info("built config")
 
-	stream := make(chan events.EngineEvent)
-	eventlog, err := os.Create(filepath.Join(s.project.PathWorkingDir(), "event.log"))
+	eventlog, err := os.Create(filepath.Join(s.project.PathStageDir(), "event.log"))
 	if err != nil {
 		return err
 	}
 	defer eventlog.Close()
 
-	complete := &CompleteEvent{
-		Links:     Links{},
-		Receivers: Receivers{},
-		Warps:     Warps{},
-		Hints:     map[string]string{},
-		Outputs:   map[string]interface{}{},
-		Errors:    []Error{},
-		Finished:  false,
-	}
-
-	go func() {
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case event, ok := <-stream:
-				if !ok {
+	// consume handles the events of a single operation, the returned channel
+	// is closed once the stream is drained
+	consume := func(stream chan events.EngineEvent) chan struct{} {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for {
+				select {
+				case <-ctx.Done():
 					return
-				}
+				case event, ok := <-stream:
+					if !ok {
+						return
+					}
 
-				if event.DiagnosticEvent != nil && event.DiagnosticEvent.Severity == "error" {
-					if strings.HasPrefix(event.DiagnosticEvent.Message, "update failed") {
-						break
+					if event.DiagnosticEvent != nil && event.DiagnosticEvent.Severity == "error" {
+						if strings.HasPrefix(event.DiagnosticEvent.Message, "update failed") {
+							break
+						}
+						complete.Errors = append(complete.Errors, Error{
+							Message: event.DiagnosticEvent.Message,
+							URN:     event.DiagnosticEvent.URN,
+						})
 					}
-					complete.Errors = append(complete.Errors, Error{
-						Message: event.DiagnosticEvent.Message,
-						URN:     event.DiagnosticEvent.URN,
-					})
-				}
 
-				input.OnEvent(&StackEvent{EngineEvent: event})
+					if event.ResOutputsEvent != nil && event.ResOutputsEvent.Metadata.Op != apitype.OpSame && event.ResOutputsEvent.Metadata.Type != "pulumi:pulumi:Stack" {
+						changes[string(event.ResOutputsEvent.Metadata.Op)]++
+					}
 
-				if event.SummaryEvent != nil {
-					complete.Finished = true
-				}
+					input.OnEvent(&StackEvent{EngineEvent: event})
 
-				bytes, err := json.Marshal(event)
-				if err != nil {
-					return
+					if event.SummaryEvent != nil {
+						complete.Finished = true
+						complete.Retained = retained
+					}
+
+					bytes, err := json.Marshal(event)
+					if err != nil {
+						return
+					}
+					eventlog.Write(bytes)
+					eventlog.WriteString("\n")
 				}
-				eventlog.Write(bytes)
-				eventlog.WriteString("\n")
 			}
-		}
-	}()
+		}()
+		return done
+	}
+
+	if !input.Dev {
+		s.notify(NotificationStarted, input.Command, started, git, nil)
+	}
 
 	defer func() {
 		slog.Info("stack command complete")
-		defer input.OnEvent(&StackEvent{CompleteEvent: complete})
+		input.OnEvent(&StackEvent{CompleteEvent: complete})
+	}()
 
+	defer func() {
+		if err != nil || input.Dev {
+			return
+		}
+		hookErr := s.runHook(input, true, env, complete)
+		if hookErr != nil {
+			complete.Errors = append(complete.Errors, Error{
+				Message: hookErr.Error(),
+			})
+			err = ErrStackRunFailed
+		}
+	}()
+
+	defer func() {
 		rawDeploment, _ := stack.Export(context.Background())
 		var deployment apitype.DeploymentV3
 		json.Unmarshal(rawDeploment.Deployment, &deployment)
@@ -341,13 +551,7 @@ func (s *stack) Run(ctx context.Context, input *StackInput) error {
 			for key, value := range links {
 				complete.Links[key] = value
 			}
-			typesFile, _ := os.Create(filepath.Join(s.project.PathWorkingDir(), "types.generated.ts"))
-			defer typesFile.Close()
-			typesFile.WriteString(`import "sst"` + "\n")
-			typesFile.WriteString(`declare module "sst" {` + "\n")
-			typesFile.WriteString("  export interface Resource " + inferTypes(links, "  ") + "\n")
-			typesFile.WriteString("}" + "\n")
-			typesFile.WriteString("export {}")
+			s.project.writeLinkTypes(links)
 			provider.PutLinks(s.project.home, s.project.app.Name, s.project.app.Stage, links)
 		}
 
@@ -395,25 +599,67 @@ func (s *stack) Run(ctx context.Context, input *StackInput) error {
 	slog.Info("running stack command", "cmd", input.Command)
 	switch input.Command {
 	case "up":
-		_, err = stack.Up(ctx,
-			optup.ProgressStreams(),
-			optup.ErrorProgressStreams(),
-			optup.EventStreams(stream),
-		)
+		for attempt := 1; ; attempt++ {
+			if attempt > 1 {
+				// the summary and history only count the changes of the
+				// last attempt
+				complete.Errors = []Error{}
+				complete.Finished = false
+				for op := range changes {
+					delete(changes, op)
+				}
+			}
+			stream := make(chan events.EngineEvent)
+			done := consume(stream)
+			_, err = stack.Up(ctx,
+				optup.ProgressStreams(),
+				optup.ErrorProgressStreams(),
+				optup.EventStreams(stream),
+			)
+			waitDrained(done)
+			if err == nil || ctx.Err() != nil || input.interrupted() || attempt >= retrier.max || !retrier.retryable(complete.Errors) {
+				break
+			}
+			// the whole program is run again instead of targeting the failed
+			// resources, since pulumi stops scheduling the remaining ones
+			// after the first error and those would never be created
+			delay := retrier.delay(attempt)
+			slog.Info("retrying", "attempt", attempt+1, "delay", delay)
+			input.OnEvent(&StackEvent{RetryEvent: &RetryEvent{
+				Attempt: attempt + 1,
+				Max:     retrier.max,
+				Delay:   delay,
+				Errors:  complete.Errors,
+			}})
+			select {
+			case <-ctx.Done():
+			case <-input.Interrupted:
+			case <-time.After(delay):
+			}
+			if ctx.Err() != nil || input.interrupted() {
+				break
+			}
+		}
 
 	case "destroy":
+		stream := make(chan events.EngineEvent)
+		done := consume(stream)
 		_, err = stack.Destroy(ctx,
 			optdestroy.ProgressStreams(),
 			optdestroy.ErrorProgressStreams(),
 			optdestroy.EventStreams(stream),
 		)
+		waitDrained(done)
 
 	case "refresh":
+		stream := make(chan events.EngineEvent)
+		done := consume(stream)
 		_, err = stack.Refresh(ctx,
 			optrefresh.ProgressStreams(),
 			optrefresh.ErrorProgressStreams(),
 			optrefresh.EventStreams(stream),
 		)
+		waitDrained(done)
 	}
 
 	slog.Info("done running stack command")
@@ -423,6 +669,104 @@ func (s *stack) Run(ctx context.Context, input *StackInput) error {
 	return nil
 }
 
+// waitDrained waits for the events of an operation to be handled. The stream
+// is not closed if pulumi fails before it starts tailing the event log, so
+// this gives up after a while instead of hanging.
+func waitDrained(done chan struct{}) {
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		slog.Error("timed out waiting for events")
+	}
+}
+
+// hasProtected reports whether the stage has resources of a protected type.
+func (s *stack) hasProtected(ctx context.Context, stack auto.Stack) (bool, error) {
+	export, err := stack.Export(ctx)
+	if err != nil {
+		return false, err
+	}
+	var deployment apitype.DeploymentV3
+	if len(export.Deployment) > 0 {
+		err = json.Unmarshal(export.Deployment, &deployment)
+		if err != nil {
+			return false, err
+		}
+	}
+	for _, resource := range deployment.Resources {
+		if s.project.app.IsProtected(string(resource.Type)) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// preview returns the resources as they will be after the deploy, and the
+// protected resources that would be replaced or deleted. If it fails, it also
+// returns the errors reported by the program.
+func (s *stack) preview(ctx context.Context, stack auto.Stack) ([]PlannedResource, []DestructiveChange, []Error, error) {
+	slog.Info("previewing changes")
+	stream := make(chan events.EngineEvent)
+	planned := []PlannedResource{}
+	changes := []DestructiveChange{}
+	errors := []Error{}
+	seen := map[string]bool{}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for event := range stream {
+			if event.DiagnosticEvent != nil && event.DiagnosticEvent.Severity == "error" {
+				if !strings.HasPrefix(event.DiagnosticEvent.Message, "preview failed") {
+					errors = append(errors, Error{
+						Message: event.DiagnosticEvent.Message,
+						URN:     event.DiagnosticEvent.URN,
+					})
+				}
+			}
+			if event.ResourcePreEvent == nil {
+				continue
+			}
+			metadata := event.ResourcePreEvent.Metadata
+			switch metadata.Op {
+			case apitype.OpReplace, apitype.OpCreateReplacement, apitype.OpDelete, apitype.OpDeleteReplaced:
+				// a replace is made of several steps on the same resource, so
+				// it is only listed once
+				if s.project.app.IsProtected(metadata.Type) && !seen[metadata.URN] {
+					seen[metadata.URN] = true
+					op := metadata.Op
+					if op != apitype.OpDelete {
+						op = apitype.OpReplace
+					}
+					changes = append(changes, DestructiveChange{
+						URN:  metadata.URN,
+						Type: metadata.Type,
+						Op:   op,
+					})
+				}
+			}
+			switch metadata.Op {
+			case apitype.OpDelete, apitype.OpDeleteReplaced, apitype.OpDiscardReplaced, apitype.OpRead, apitype.OpReadDiscard:
+				continue
+			}
+			if metadata.New == nil || metadata.Type == "pulumi:pulumi:Stack" {
+				continue
+			}
+			planned = append(planned, PlannedResource{
+				URN:    metadata.URN,
+				Type:   metadata.Type,
+				Op:     metadata.Op,
+				Inputs: metadata.New.Inputs,
+			})
+		}
+	}()
+	_, err := stack.Preview(ctx, optpreview.EventStreams(stream))
+	waitDrained(done)
+	if err != nil {
+		return nil, nil, errors, err
+	}
+	return planned, changes, nil, nil
+}
+
 type ImportOptions struct {
 	Type   string
 	Name   string
@@ -467,20 +811,20 @@ func (s *stack) Import(ctx context.Context, input *ImportOptions) error {
 	if err != nil {
 		return err
 	}
-	env, err := s.project.home.Env()
+	env, err := s.project.providerEnv()
 	if err != nil {
 		return err
 	}
 	env["PULUMI_CONFIG_PASSPHRASE"] = passphrase
 
 	ws, err := auto.NewLocalWorkspace(ctx,
-		auto.WorkDir(s.project.PathWorkingDir()),
+		auto.WorkDir(s.project.PathStageDir()),
 		auto.PulumiHome(global.ConfigDir()),
 		auto.Project(workspace.Project{
 			Name:    tokens.PackageName(s.project.app.Name),
 			Runtime: workspace.NewProjectRuntimeInfo("nodejs", nil),
 			Backend: &workspace.ProjectBackend{
-				URL: fmt.Sprintf("file://%v", s.project.PathWorkingDir()),
+				URL: fmt.Sprintf("file://%v", s.project.PathStageDir()),
 			},
 		}),
 		auto.EnvVars(env),
@@ -494,23 +838,7 @@ func (s *stack) Import(ctx context.Context, input *ImportOptions) error {
 		return err
 	}
 
-	config := auto.ConfigMap{}
-	for provider, args := range s.project.app.Providers {
-		for key, value := range args.(map[string]interface{}) {
-			if key == "version" {
-				continue
-			}
-			switch v := value.(type) {
-			case string:
-				config[fmt.Sprintf("%v:%v", provider, key)] = auto.ConfigValue{Value: v}
-			case []string:
-				for i, val := range v {
-					config[fmt.Sprintf("%v:%v[%d]", provider, key, i)] = auto.ConfigValue{Value: val}
-				}
-			}
-		}
-	}
-	err = stack.SetAllConfig(ctx, config)
+	err = s.setProviderConfig(ctx, stack)
 	if err != nil {
 		return err
 	}
@@ -562,14 +890,107 @@ func (s *stack) Import(ctx context.Context, input *ImportOptions) error {
 	return s.PushState()
 }
 
+// Deployment returns the last deployment from state without running the
+// program.
+func (s *stack) Deployment(ctx context.Context) (*apitype.DeploymentV3, error) {
+	_, err := s.PullState()
+	if err != nil {
+		if errors.Is(err, provider.ErrStateNotFound) {
+			return nil, ErrStageNotFound
+		}
+		return nil, err
+	}
+
+	passphrase, err := provider.Passphrase(s.project.home, s.project.app.Name, s.project.app.Stage)
+	if err != nil {
+		return nil, err
+	}
+	env, err := s.project.home.Env()
+	if err != nil {
+		return nil, err
+	}
+	env["PULUMI_CONFIG_PASSPHRASE"] = passphrase
+
+	ws, err := auto.NewLocalWorkspace(ctx,
+		auto.WorkDir(s.project.PathStageDir()),
+		auto.PulumiHome(global.ConfigDir()),
+		auto.Project(workspace.Project{
+			Name:    tokens.PackageName(s.project.app.Name),
+			Runtime: workspace.NewProjectRuntimeInfo("nodejs", nil),
+			Backend: &workspace.ProjectBackend{
+				URL: fmt.Sprintf("file://%v", s.project.PathStageDir()),
+			},
+		}),
+		auto.EnvVars(env),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	stack, err := auto.SelectStack(ctx, s.project.app.Stage, ws)
+	if err != nil {
+		return nil, err
+	}
+
+	export, err := stack.Export(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var deployment apitype.DeploymentV3
+	err = json.Unmarshal(export.Deployment, &deployment)
+	if err != nil {
+		return nil, err
+	}
+	return &deployment, nil
+}
+
+// PartitionRetained splits the resources in a deployment into the ones that
+// will be deleted on remove and the ones that will be retained. Component
+// resources and providers are skipped since they don't exist in the cloud.
+func PartitionRetained(resources []apitype.ResourceV3) (removed []apitype.ResourceV3, retained []apitype.ResourceV3) {
+	removed = []apitype.ResourceV3{}
+	retained = []apitype.ResourceV3{}
+	for _, item := range resources {
+		if !item.Custom || strings.HasPrefix(string(item.Type), "pulumi:providers:") {
+			continue
+		}
+		if item.RetainOnDelete {
+			retained = append(retained, item)
+			continue
+		}
+		removed = append(removed, item)
+	}
+	return removed, retained
+}
+
+// Outputs returns the outputs of the last deployment from state without
+// running the program.
+func (s *stack) Outputs(ctx context.Context) (map[string]interface{}, error) {
+	deployment, err := s.Deployment(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]interface{}{}
+	if len(deployment.Resources) == 0 {
+		return result, nil
+	}
+	for key, value := range decrypt(deployment.Resources[0].Outputs) {
+		if strings.HasPrefix(key, "_") {
+			continue
+		}
+		result[key] = value
+	}
+	return result, nil
+}
+
 func (s *stack) Lock() error {
 	return provider.Lock(s.project.home, s.project.app.Name, s.project.app.Stage)
 }
 
 func (s *stack) Unlock() error {
-	dir := s.project.PathWorkingDir()
+	dir := s.project.PathStageDir()
 	files, err := os.ReadDir(dir)
-	if err != nil {
+	if err != nil && !os.IsNotExist(err) {
 		return err
 	}
 
@@ -586,7 +1007,7 @@ func (s *stack) Unlock() error {
 }
 
 func (s *stack) PullState() (string, error) {
-	pulumiDir := filepath.Join(s.project.PathWorkingDir(), ".pulumi")
+	pulumiDir := filepath.Join(s.project.PathStageDir(), ".pulumi")
 	err := os.RemoveAll(pulumiDir)
 	if err != nil {
 		return "", err
@@ -609,16 +1030,58 @@ func (s *stack) PullState() (string, error) {
 	return path, nil
 }
 
+func (s *stack) statePath() string {
+	pulumiDir := filepath.Join(s.project.PathStageDir(), ".pulumi")
+	return filepath.Join(pulumiDir, "stacks", s.project.app.Name, fmt.Sprintf("%v.json", s.project.app.Stage))
+}
+
 func (s *stack) PushState() error {
-	pulumiDir := filepath.Join(s.project.PathWorkingDir(), ".pulumi")
 	return provider.PushState(
 		s.project.home,
 		s.project.app.Name,
 		s.project.app.Stage,
-		filepath.Join(pulumiDir, "stacks", s.project.app.Name, fmt.Sprintf("%v.json", s.project.app.Stage)),
+		s.statePath(),
 	)
 }
 
+// SaveRecovery copies the local state to the recovery directory, for when it
+// could not be pushed to the home.
+func (s *stack) SaveRecovery() (string, error) {
+	data, err := os.ReadFile(s.statePath())
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(s.project.PathWorkingDir(), "recovery")
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%v-%v.json", s.project.app.Stage, time.Now().Unix()))
+	return path, os.WriteFile(path, data, 0644)
+}
+
+// RestoreState replaces the state in the home with the given file.
+func (s *stack) RestoreState(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var deployment apitype.UntypedDeployment
+	err = json.Unmarshal(data, &deployment)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(s.statePath()), 0755)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(s.statePath(), data, 0644)
+	if err != nil {
+		return err
+	}
+	return s.PushState()
+}
+
 func (s *stack) Cancel() error {
 	return provider.Unlock(
 		s.project.home,
@@ -1,8 +1,13 @@
 package project
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
 )
 
@@ -28,3 +33,139 @@ func SetPersonalStage(cfgPath string, stage string) error {
 	}
 	return nil
 }
+
+// MaxStageLength is the longest stage name a strategy derives. Longer names
+// are truncated and suffixed with a hash so they stay unique.
+const MaxStageLength = 32
+
+var stageInvalidChars = regexp.MustCompile(`[^a-z0-9-]+`)
+var stagePlaceholder = regexp.MustCompile(`\{([a-z]+)\}`)
+
+// DeriveStage builds a stage name from a strategy. The strategy is either
+// "branch", "user", or a template like "{user}-{branch}".
+func DeriveStage(cfgPath string, strategy string, username string) (string, error) {
+	template := strategy
+	switch strategy {
+	case "branch", "user":
+		template = "{" + strategy + "}"
+	}
+	if !strings.Contains(template, "{") {
+		return "", fmt.Errorf("unknown stage strategy \"%s\", use branch, user, or a template like {user}-{branch}", strategy)
+	}
+
+	var err error
+	result := stagePlaceholder.ReplaceAllStringFunc(template, func(match string) string {
+		switch name := match[1 : len(match)-1]; name {
+		case "user":
+			if username == "" {
+				err = fmt.Errorf("could not get the current user")
+			}
+			return username
+		case "branch":
+			info, _ := gitInfo(filepath.Dir(cfgPath))
+			if info == nil || info.Branch == "" {
+				err = fmt.Errorf("could not get the current git branch")
+				return ""
+			}
+			return info.Branch
+		default:
+			err = fmt.Errorf("unknown placeholder \"%s\" in stage strategy", match)
+			return ""
+		}
+	})
+	if err != nil {
+		return "", err
+	}
+
+	stage := SanitizeStage(result)
+	if stage == "" {
+		return "", fmt.Errorf("stage strategy \"%s\" resolved to an empty stage", strategy)
+	}
+	return stage, nil
+}
+
+// SanitizeStage turns any string into a valid stage name. Names longer than
+// MaxStageLength are truncated and suffixed with a short hash of the full
+// name, so the same input always maps to the same stage.
+func SanitizeStage(input string) string {
+	stage := strings.ToLower(input)
+	stage = stageInvalidChars.ReplaceAllString(stage, "-")
+	stage = strings.Trim(stage, "-")
+	if len(stage) <= MaxStageLength {
+		return stage
+	}
+	sum := sha256.Sum256([]byte(stage))
+	hash := hex.EncodeToString(sum[:])[:8]
+	prefix := strings.TrimRight(stage[:MaxStageLength-len(hash)-1], "-")
+	return prefix + "-" + hash
+}
+
+// StageConfig overrides the app config for the stages that match a pattern.
+type StageConfig struct {
+	Providers map[string]interface{} `json:"providers"`
+}
+
+// stageOverrides returns the overrides that match the stage, from the least
+// to the most specific. Patterns with a * come first, shorter ones before
+// longer ones, and an exact match is applied last.
+func stageOverrides(stages map[string]StageConfig, stage string) []StageConfig {
+	patterns := []string{}
+	for pattern := range stages {
+		if pattern == stage {
+			continue
+		}
+		if ok, _ := filepath.Match(pattern, stage); ok {
+			patterns = append(patterns, pattern)
+		}
+	}
+	sort.Slice(patterns, func(i, j int) bool {
+		if len(patterns[i]) != len(patterns[j]) {
+			return len(patterns[i]) < len(patterns[j])
+		}
+		return patterns[i] < patterns[j]
+	})
+	result := []StageConfig{}
+	for _, pattern := range patterns {
+		result = append(result, stages[pattern])
+	}
+	if exact, ok := stages[stage]; ok {
+		result = append(result, exact)
+	}
+	return result
+}
+
+// mergeProviders applies the provider args of a stage override on top of the
+// app providers. Args are replaced key by key, so an override only needs the
+// args that are different for the stage.
+func mergeProviders(providers map[string]interface{}, overrides map[string]interface{}) error {
+	for name, args := range overrides {
+		next, ok := args.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("the args of the \"%s\" provider in \"stages\" have to be an object", name)
+		}
+		current, ok := providers[name].(map[string]interface{})
+		if !ok {
+			current = map[string]interface{}{}
+		}
+		for key, value := range next {
+			current[key] = value
+		}
+		providers[name] = current
+	}
+	return nil
+}
+
+// applyStages applies the overrides of the stages that match the stage of
+// the app to its providers.
+func (app *App) applyStages() error {
+	if app.Providers == nil {
+		app.Providers = map[string]interface{}{}
+	}
+	for _, override := range stageOverrides(app.Stages, app.Stage) {
+		err := mergeProviders(app.Providers, override.Providers)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package project
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSanitizeStage(t *testing.T) {
+	cases := map[string]string{
+		"main":                    "main",
+		"feature/Add-Login":       "feature-add-login",
+		"dependabot/npm_and_yarn": "dependabot-npm-and-yarn",
+		"--fix--":                 "fix",
+	}
+	for input, expected := range cases {
+		if actual := SanitizeStage(input); actual != expected {
+			t.Errorf("SanitizeStage(%q) = %q, expected %q", input, actual, expected)
+		}
+	}
+
+	long := "feature/a-really-long-branch-name-that-goes-on-and-on"
+	first := SanitizeStage(long)
+	if len(first) > MaxStageLength {
+		t.Errorf("expected at most %d characters, got %q", MaxStageLength, first)
+	}
+	if !StageRegex.MatchString(first) {
+		t.Errorf("expected a valid stage, got %q", first)
+	}
+	if first != SanitizeStage(long) {
+		t.Errorf("expected the same stage for the same input")
+	}
+	if first == SanitizeStage(strings.Replace(long, "on-and-on", "on-and-off", 1)) {
+		t.Errorf("expected different stages for different inputs")
+	}
+}
+
+func TestStageOverrides(t *testing.T) {
+	stages := map[string]StageConfig{
+		"*": {Providers: map[string]interface{}{
+			"aws": map[string]interface{}{"profile": "dev"},
+		}},
+		"prod*": {Providers: map[string]interface{}{
+			"aws": map[string]interface{}{"profile": "prod", "region": "eu-west-1"},
+		}},
+		"production": {Providers: map[string]interface{}{
+			"aws": map[string]interface{}{"region": "eu-central-1"},
+		}},
+	}
+	providers := map[string]interface{}{
+		"aws": map[string]interface{}{"region": "us-east-1"},
+	}
+	for _, override := range stageOverrides(stages, "production") {
+		if err := mergeProviders(providers, override.Providers); err != nil {
+			t.Fatal(err)
+		}
+	}
+	aws := providers["aws"].(map[string]interface{})
+	if aws["profile"] != "prod" || aws["region"] != "eu-central-1" {
+		t.Errorf("unexpected aws args for production: %v", aws)
+	}
+
+	if overrides := stageOverrides(stages, "dev"); len(overrides) != 1 {
+		t.Errorf("expected only the * override for dev, got %d", len(overrides))
+	}
+}
+
+func TestNewAppliesStages(t *testing.T) {
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "sst.config.ts")
+	err := os.WriteFile(cfgPath, []byte(`
+export default $config({
+  app(input) {
+    return {
+      name: "app",
+      home: "aws",
+      providers: { aws: { region: "us-east-1" }, cloudflare: true },
+      stages: {
+        "prod*": { providers: { aws: { profile: "prod" } } },
+        production: { providers: { aws: { region: "eu-central-1" } } },
+      },
+    };
+  },
+  async run() {},
+});
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := New(&ProjectConfig{Config: cfgPath, Stage: "production"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	aws := p.App().Providers["aws"].(map[string]interface{})
+	if aws["profile"] != "prod" || aws["region"] != "eu-central-1" {
+		t.Errorf("unexpected aws args for production: %v", aws)
+	}
+	if _, ok := p.App().Providers["cloudflare"].(map[string]interface{}); !ok {
+		t.Errorf("expected cloudflare to be normalized to a map")
+	}
+
+	err = os.WriteFile(cfgPath, []byte(`
+export default $config({
+  app(input) {
+    return {
+      name: "app",
+      home: "aws",
+      stages: { production: { providers: { aws: "prod" } } },
+    };
+  },
+  async run() {},
+});
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = New(&ProjectConfig{Config: cfgPath, Stage: "production"})
+	if err == nil {
+		t.Errorf("expected an override that is not an object to fail")
+	}
+}
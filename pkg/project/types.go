@@ -1,9 +1,39 @@
 package project
 
 import (
+	"log/slog"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 )
 
+// typesLock serializes writing the types, since stages deployed in parallel
+// share the file.
+var typesLock sync.Mutex
+
+// writeLinkTypes writes the types of the links to the working directory. The file
+// is shared by every stage, so it is replaced at once instead of being
+// written in place.
+func (p *Project) writeLinkTypes(links map[string]interface{}) {
+	typesLock.Lock()
+	defer typesLock.Unlock()
+	var builder strings.Builder
+	builder.WriteString(`import "sst"` + "\n")
+	builder.WriteString(`declare module "sst" {` + "\n")
+	builder.WriteString("  export interface Resource " + inferTypes(links, "  ") + "\n")
+	builder.WriteString("}" + "\n")
+	builder.WriteString("export {}")
+	path := filepath.Join(p.PathWorkingDir(), "types.generated.ts")
+	err := os.WriteFile(path+".tmp", []byte(builder.String()), 0644)
+	if err == nil {
+		err = os.Rename(path+".tmp", path)
+	}
+	if err != nil {
+		slog.Error("failed to write types", "err", err)
+	}
+}
+
 func inferTypes(input map[string]interface{}, indentArgs ...string) string {
 	indent := ""
 	if len(indentArgs) > 0 {
@@ -0,0 +1,212 @@
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	esbuild "github.com/evanw/esbuild/pkg/api"
+	"github.com/sst/ion/internal/fs"
+)
+
+// WorkerRuntime runs Cloudflare Workers locally in sst dev. The worker is
+// bundled the same way it is deployed and served by a small Node runtime that
+// implements the module worker interface.
+type WorkerRuntime struct {
+	contexts map[string]esbuild.BuildContext
+	results  map[string]esbuild.BuildResult
+}
+
+func newWorkerRuntime() *WorkerRuntime {
+	return &WorkerRuntime{
+		contexts: map[string]esbuild.BuildContext{},
+		results:  map[string]esbuild.BuildResult{},
+	}
+}
+
+type WorkerProperties struct {
+	Build struct {
+		Loader map[string]string `json:"loader"`
+		Banner string            `json:"banner"`
+		Minify bool              `json:"minify"`
+	} `json:"build"`
+}
+
+type workerProcess struct {
+	stdout io.ReadCloser
+	stderr io.ReadCloser
+	cmd    *exec.Cmd
+}
+
+func (w *workerProcess) Stop() {
+	w.cmd.Process.Signal(os.Interrupt)
+}
+
+func (w *workerProcess) Logs() io.ReadCloser {
+	reader, writer := io.Pipe()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		_, _ = io.Copy(writer, w.stdout)
+	}()
+	go func() {
+		defer wg.Done()
+		_, _ = io.Copy(writer, w.stderr)
+	}()
+
+	go func() {
+		wg.Wait()
+		defer writer.Close()
+	}()
+
+	return reader
+}
+
+func (r *WorkerRuntime) Build(ctx context.Context, input *BuildInput) (*BuildOutput, error) {
+	var properties WorkerProperties
+	json.Unmarshal(input.Warp.Properties, &properties)
+
+	file := filepath.Join(input.Project.PathRoot(), input.Warp.Handler)
+	if _, err := os.Stat(file); err != nil {
+		return nil, fmt.Errorf("Handler not found: %v", input.Warp.Handler)
+	}
+	target := filepath.Join(input.Out(), "index.mjs")
+
+	loader := map[string]esbuild.Loader{}
+	loaderMap := map[string]esbuild.Loader{
+		"js":      esbuild.LoaderJS,
+		"jsx":     esbuild.LoaderJSX,
+		"ts":      esbuild.LoaderTS,
+		"tsx":     esbuild.LoaderTSX,
+		"css":     esbuild.LoaderCSS,
+		"json":    esbuild.LoaderJSON,
+		"text":    esbuild.LoaderText,
+		"base64":  esbuild.LoaderBase64,
+		"file":    esbuild.LoaderFile,
+		"dataurl": esbuild.LoaderDataURL,
+		"binary":  esbuild.LoaderBinary,
+	}
+	for key, value := range properties.Build.Loader {
+		mapped, ok := loaderMap[value]
+		if !ok {
+			continue
+		}
+		loader[key] = mapped
+	}
+
+	links, _ := json.Marshal(input.Links)
+	options := esbuild.BuildOptions{
+		EntryPoints: []string{file},
+		Platform:    esbuild.PlatformNode,
+		Format:      esbuild.FormatESModule,
+		Target:      esbuild.ESNext,
+		MainFields:  []string{"module", "main"},
+		Sourcemap:   esbuild.SourceMapLinked,
+		Loader:      loader,
+		KeepNames:   true,
+		Bundle:      true,
+		Metafile:    true,
+		Write:       true,
+		Outfile:     target,
+		Banner: map[string]string{
+			"js": strings.Join([]string{
+				`globalThis.$SST_LINKS = ` + string(links) + ";",
+				properties.Build.Banner,
+			}, "\n"),
+		},
+		MinifyWhitespace:  properties.Build.Minify,
+		MinifySyntax:      properties.Build.Minify,
+		MinifyIdentifiers: properties.Build.Minify,
+	}
+
+	// the links are part of the banner, so the context is recreated instead
+	// of reused when they change
+	if buildContext, ok := r.contexts[input.Warp.FunctionID]; ok {
+		buildContext.Dispose()
+	}
+	buildContext, _ := esbuild.Context(options)
+	r.contexts[input.Warp.FunctionID] = buildContext
+
+	result := buildContext.Rebuild()
+	r.results[input.Warp.FunctionID] = result
+	errors := []string{}
+	for _, error := range result.Errors {
+		slog.Error("esbuild error", "error", error)
+		errors = append(errors, error.Text)
+	}
+
+	nodeModules, err := fs.FindUp(file, "node_modules")
+	if err == nil {
+		os.Symlink(nodeModules, filepath.Join(input.Out(), "node_modules"))
+	}
+
+	return &BuildOutput{
+		Handler: "index.mjs",
+		Errors:  errors,
+	}, nil
+}
+
+// Run starts the worker listening on the address in input.Server.
+func (r *WorkerRuntime) Run(ctx context.Context, input *RunInput) (Worker, error) {
+	cmd := exec.CommandContext(
+		ctx,
+		"node",
+		"--enable-source-maps",
+		filepath.Join(
+			input.Project.PathPlatformDir(),
+			"/dist/worker-runtime/index.js",
+		),
+		filepath.Join(input.Build.Out, input.Build.Handler),
+		input.Server,
+	)
+	cmd.Env = input.Env
+	cmd.Dir = input.Build.Out
+	stdout, _ := cmd.StdoutPipe()
+	stderr, _ := cmd.StderrPipe()
+	err := cmd.Start()
+	if err != nil {
+		return nil, err
+	}
+	return &workerProcess{
+		stdout,
+		stderr,
+		cmd,
+	}, nil
+}
+
+func (r *WorkerRuntime) Match(runtime string) bool {
+	return runtime == "worker"
+}
+
+func (r *WorkerRuntime) ShouldRebuild(functionID string, file string) bool {
+	result, ok := r.results[functionID]
+	if !ok {
+		return false
+	}
+
+	var meta = map[string]interface{}{}
+	err := json.Unmarshal([]byte(result.Metafile), &meta)
+	if err != nil {
+		return false
+	}
+	for key := range meta["inputs"].(map[string]interface{}) {
+		absPath, err := filepath.Abs(key)
+		if err != nil {
+			continue
+		}
+		if absPath == file {
+			return true
+		}
+	}
+
+	return false
+}
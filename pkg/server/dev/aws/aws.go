@@ -79,8 +79,6 @@ func Start(
 	p *project.Project,
 	port int,
 ) (util.CleanupFunc, error) {
-	expire := time.Hour * 24
-	from := time.Now()
 	server := fmt.Sprintf("localhost:%d/lambda/", port)
 
 	config := aws.Config()
@@ -90,89 +88,10 @@ func Start(
 	if err != nil {
 		return nil, err
 	}
-
-	originalURL, err := url.Parse(fmt.Sprintf("wss://%s/mqtt?X-Amz-Expires=%s", *endpointResp.EndpointAddress, strconv.FormatInt(int64(expire/time.Second), 10)))
-	if err != nil {
-		return nil, err
-	}
-	slog.Info("found endpoint endpoint", "url", originalURL.String())
-
-	creds, err := config.Credentials.Retrieve(ctx)
-	if err != nil {
-		return nil, err
-	}
-	sessionToken := creds.SessionToken
-	creds.SessionToken = ""
-
-	signer := v4.NewSigner()
-	req := &http.Request{
-		Method: "GET",
-		URL:    originalURL,
-	}
-
-	presignedURL, _, err := signer.PresignHTTP(ctx, creds, req, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", "iotdevicegateway", config.Region, from)
-	if err != nil {
-		return nil, err
-	}
-	slog.Info("signed request", "url", presignedURL)
-	if sessionToken != "" {
-		presignedURL += "&X-Amz-Security-Token=" + url.QueryEscape(sessionToken)
-	}
-
-	opts := MQTT.
-		NewClientOptions().
-		AddBroker(presignedURL).
-		SetClientID(
-			hex.EncodeToString(func(b []byte) []byte { _, _ = rand.Read(b); return b }(make([]byte, 16))),
-		).
-		SetTLSConfig(&tls.Config{
-			InsecureSkipVerify: true,
-		}).
-		SetWebsocketOptions(&MQTT.WebsocketOptions{
-			ReadBufferSize:  1024 * 1000,
-			WriteBufferSize: 1024 * 1000,
-		}).
-		SetCleanSession(false).
-		SetAutoReconnect(true).
-		SetConnectionLostHandler(func(c MQTT.Client, err error) {
-			slog.Info("mqtt connection lost", "error", err)
-		}).
-		SetReconnectingHandler(func(c MQTT.Client, co *MQTT.ClientOptions) {
-			slog.Info("mqtt reconnecting")
-		}).
-		SetOnConnectHandler(func(c MQTT.Client) {
-			slog.Info("mqtt connected")
-		}).
-		SetKeepAlive(time.Second * 1200).
-		SetPingTimeout(time.Second * 60)
-
-	mqttClient := MQTT.NewClient(opts)
-	if token := mqttClient.Connect(); token.Wait() && token.Error() != nil {
-		return nil, token.Error()
-	}
+	endpoint := *endpointResp.EndpointAddress
 
 	var pending sync.Map
 
-	prefix := fmt.Sprintf("ion/%s/%s", p.App().Name, p.App().Stage)
-	if token := mqttClient.Subscribe(prefix+"/+/response", 1, func(c MQTT.Client, m MQTT.Message) {
-		slog.Info("iot", "topic", m.Topic())
-		workerID := strings.Split(m.Topic(), "/")[3]
-		payload := m.Payload()
-		go func() {
-			write, ok := pending.Load(workerID)
-			if !ok {
-				slog.Info("asking for reboot", "workerID", workerID)
-				mqttClient.Publish(prefix+"/"+workerID+"/reboot", 1, false, []byte("reboot"))
-				return
-			}
-			casted := write.(*io.PipeWriter)
-			casted.Write(payload)
-			casted.Close()
-		}()
-	}); token.Wait() && token.Error() != nil {
-		return nil, token.Error()
-	}
-
 	type WorkerInfo struct {
 		FunctionID       string
 		WorkerID         string
@@ -205,19 +124,98 @@ func Start(
 		fileChan <- event
 	})
 
-	if token := mqttClient.Subscribe(prefix+"/+/init", 1, func(c MQTT.Client, m MQTT.Message) {
-		slog.Info("iot", "topic", m.Topic())
-		initChan <- m
-	}); token.Wait() && token.Error() != nil {
-		return nil, token.Error()
+	var mqttLock sync.Mutex
+	var mqttClient MQTT.Client
+	currentClient := func() MQTT.Client {
+		mqttLock.Lock()
+		defer mqttLock.Unlock()
+		return mqttClient
+	}
+	// while a connection is replaced both clients are subscribed, so only the
+	// current one handles the messages and they are not handled twice
+	stale := func(c MQTT.Client) bool {
+		current := currentClient()
+		return current != nil && current != c
 	}
 
-	if token := mqttClient.Subscribe(prefix+"/+/shutdown", 1, func(c MQTT.Client, m MQTT.Message) {
-		slog.Info("iot", "topic", m.Topic())
-		shutdownChan <- m
-	}); token.Wait() && token.Error() != nil {
-		return nil, token.Error()
+	prefix := fmt.Sprintf("ion/%s/%s", p.App().Name, p.App().Stage)
+	subscribe := func(mqttClient MQTT.Client) error {
+		if token := mqttClient.Subscribe(prefix+"/+/response", 1, func(c MQTT.Client, m MQTT.Message) {
+			if stale(c) {
+				return
+			}
+			slog.Info("iot", "topic", m.Topic())
+			workerID := strings.Split(m.Topic(), "/")[3]
+			payload := m.Payload()
+			go func() {
+				write, ok := pending.Load(workerID)
+				if !ok {
+					slog.Info("asking for reboot", "workerID", workerID)
+					c.Publish(prefix+"/"+workerID+"/reboot", 1, false, []byte("reboot"))
+					return
+				}
+				casted := write.(*io.PipeWriter)
+				casted.Write(payload)
+				casted.Close()
+			}()
+		}); token.Wait() && token.Error() != nil {
+			return token.Error()
+		}
+
+		if token := mqttClient.Subscribe(prefix+"/+/init", 1, func(c MQTT.Client, m MQTT.Message) {
+			if stale(c) {
+				return
+			}
+			slog.Info("iot", "topic", m.Topic())
+			initChan <- m
+		}); token.Wait() && token.Error() != nil {
+			return token.Error()
+		}
+
+		if token := mqttClient.Subscribe(prefix+"/+/shutdown", 1, func(c MQTT.Client, m MQTT.Message) {
+			if stale(c) {
+				return
+			}
+			slog.Info("iot", "topic", m.Topic())
+			shutdownChan <- m
+		}); token.Wait() && token.Error() != nil {
+			return token.Error()
+		}
+		return nil
+	}
+
+	first, refreshAt, err := connect(ctx, aws, endpoint, subscribe)
+	if err != nil {
+		return nil, err
 	}
+	mqttLock.Lock()
+	mqttClient = first
+	mqttLock.Unlock()
+
+	// the presigned url stops working when it or the credentials it was signed
+	// with expire, so a new connection is opened before that happens
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Until(refreshAt)):
+			}
+			slog.Info("refreshing iot connection")
+			next, nextRefreshAt, err := connect(ctx, aws, endpoint, subscribe)
+			if err != nil {
+				slog.Error("failed to refresh iot connection", "err", err)
+				refreshAt = time.Now().Add(time.Minute)
+				continue
+			}
+			mqttLock.Lock()
+			previous := mqttClient
+			mqttClient = next
+			mqttLock.Unlock()
+			previous.Disconnect(250)
+			refreshAt = nextRefreshAt
+		}
+	}()
 
 	slog.Info("connected to iot")
 
@@ -435,7 +433,7 @@ func Start(
 		slog.Info("lambda request", "path", path)
 		workerID := path[2]
 		slog.Info("lambda lock", "workerID", workerID)
-		writer := iot_writer.New(mqttClient, prefix+"/"+workerID+"/request")
+		writer := iot_writer.New(currentClient(), prefix+"/"+workerID+"/request")
 		read, write := io.Pipe()
 		pending.Store(workerID, write)
 		defer pending.Delete(workerID)
@@ -509,7 +507,111 @@ func Start(
 
 	return func() error {
 		slog.Info("cleaning up iot")
-		mqttClient.Disconnect(250)
+		currentClient().Disconnect(250)
 		return nil
 	}, nil
 }
+
+// refreshWindow is how long before the credentials or the presigned url
+// expire that the connection is replaced.
+const refreshWindow = 5 * time.Minute
+
+// presign returns a url to connect to IoT with the current credentials, and
+// when the connection has to be refreshed.
+func presign(ctx context.Context, aws *provider.AwsProvider, endpoint string) (string, time.Time, error) {
+	expire := time.Hour * 24
+	from := time.Now()
+	config := aws.Config()
+
+	originalURL, err := url.Parse(fmt.Sprintf("wss://%s/mqtt?X-Amz-Expires=%s", endpoint, strconv.FormatInt(int64(expire/time.Second), 10)))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	slog.Info("found endpoint endpoint", "url", originalURL.String())
+
+	creds, err := config.Credentials.Retrieve(ctx)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	refreshAt := from.Add(expire - refreshWindow)
+	if creds.CanExpire && creds.Expires.Add(-refreshWindow).Before(refreshAt) {
+		refreshAt = creds.Expires.Add(-refreshWindow)
+	}
+	sessionToken := creds.SessionToken
+	creds.SessionToken = ""
+
+	signer := v4.NewSigner()
+	req := &http.Request{
+		Method: "GET",
+		URL:    originalURL,
+	}
+
+	presignedURL, _, err := signer.PresignHTTP(ctx, creds, req, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", "iotdevicegateway", config.Region, from)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	slog.Info("signed request", "url", presignedURL, "refresh", refreshAt)
+	if sessionToken != "" {
+		presignedURL += "&X-Amz-Security-Token=" + url.QueryEscape(sessionToken)
+	}
+	return presignedURL, refreshAt, nil
+}
+
+// connect presigns the IoT endpoint with the current credentials and opens a
+// new connection. It also returns when the connection has to be refreshed,
+// which is before either the presigned url or the credentials expire.
+func connect(ctx context.Context, aws *provider.AwsProvider, endpoint string, subscribe func(MQTT.Client) error) (MQTT.Client, time.Time, error) {
+	presignedURL, refreshAt, err := presign(ctx, aws, endpoint)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	opts := MQTT.
+		NewClientOptions().
+		AddBroker(presignedURL).
+		SetClientID(
+			hex.EncodeToString(func(b []byte) []byte { _, _ = rand.Read(b); return b }(make([]byte, 16))),
+		).
+		SetTLSConfig(&tls.Config{
+			InsecureSkipVerify: true,
+		}).
+		SetWebsocketOptions(&MQTT.WebsocketOptions{
+			ReadBufferSize:  1024 * 1000,
+			WriteBufferSize: 1024 * 1000,
+		}).
+		SetCleanSession(false).
+		SetAutoReconnect(true).
+		SetConnectionLostHandler(func(c MQTT.Client, err error) {
+			slog.Info("mqtt connection lost", "error", err)
+		}).
+		SetReconnectingHandler(func(c MQTT.Client, co *MQTT.ClientOptions) {
+			slog.Info("mqtt reconnecting")
+			// the original url stops working once it or the credentials
+			// expire, so every reconnect is signed again
+			next, _, err := presign(ctx, aws, endpoint)
+			if err != nil {
+				slog.Error("failed to sign mqtt reconnect", "err", err)
+				return
+			}
+			parsed, err := url.Parse(next)
+			if err != nil {
+				return
+			}
+			co.Servers = []*url.URL{parsed}
+		}).
+		SetOnConnectHandler(func(c MQTT.Client) {
+			slog.Info("mqtt connected")
+		}).
+		SetKeepAlive(time.Second * 1200).
+		SetPingTimeout(time.Second * 60)
+
+	mqttClient := MQTT.NewClient(opts)
+	if token := mqttClient.Connect(); token.Wait() && token.Error() != nil {
+		return nil, time.Time{}, token.Error()
+	}
+	if err := subscribe(mqttClient); err != nil {
+		mqttClient.Disconnect(250)
+		return nil, time.Time{}, err
+	}
+	return mqttClient, refreshAt, nil
+}
@@ -0,0 +1,401 @@
+package cloudflare
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sst/ion/internal/util"
+	"github.com/sst/ion/pkg/project"
+	"github.com/sst/ion/pkg/project/provider"
+	"github.com/sst/ion/pkg/runtime"
+	"github.com/sst/ion/pkg/server/bus"
+	"github.com/sst/ion/pkg/server/dev/aws"
+	"github.com/sst/ion/pkg/server/dev/watcher"
+)
+
+// FIRST_PORT is where the local workers start listening, it is the same
+// default port as wrangler.
+const FIRST_PORT = 8787
+
+// requestHeader passes the request ID to the worker runtime, which marks the
+// log lines written while handling it with logMarker and the ID.
+const requestHeader = "x-sst-request-id"
+const logMarker = "\x1f"
+
+type workerProperties struct {
+	Environment map[string]string `json:"environment"`
+	KV          []interface{}     `json:"kv"`
+	R2          []interface{}     `json:"r2"`
+	D1          []interface{}     `json:"d1"`
+	Secrets     map[string]string `json:"secrets"`
+	Service     []interface{}     `json:"service"`
+	Queue       []interface{}     `json:"queue"`
+}
+
+// worker is a worker served locally. The port it listens on stays the same
+// while the process behind it is restarted on every rebuild.
+type worker struct {
+	sync.Mutex
+	functionID string
+	warp       project.Warp
+	port       int
+	server     *http.Server
+	target     *url.URL
+	ready      chan struct{}
+	process    runtime.Worker
+}
+
+// Start runs the Cloudflare Workers of the app locally and publishes the same
+// function events as live Lambda, so the UI shows their requests and logs.
+func Start(
+	ctx context.Context,
+	cf *provider.CloudflareProvider,
+	p *project.Project,
+) (util.CleanupFunc, error) {
+	// the cleanup stops the loop itself, so it does not wait for the caller
+	// to cancel ctx
+	ctx, cancel := context.WithCancel(ctx)
+	completeChan := make(chan *project.CompleteEvent, 1000)
+	fileChan := make(chan *watcher.FileChangedEvent, 1000)
+	bus.Subscribe(ctx, func(event *project.StackEvent) {
+		if event.CompleteEvent != nil {
+			completeChan <- event.CompleteEvent
+		}
+	})
+	bus.Subscribe(ctx, func(event *watcher.FileChangedEvent) {
+		fileChan <- event
+	})
+
+	workers := map[string]*worker{}
+	ports := map[string]int{}
+	var complete *project.CompleteEvent
+
+	env := func(warp project.Warp) ([]string, error) {
+		var properties workerProperties
+		json.Unmarshal(warp.Properties, &properties)
+		vars := map[string]string{}
+		for key, value := range properties.Environment {
+			vars[key] = value
+		}
+		result := os.Environ()
+		cfEnv, err := cf.Env()
+		if err != nil {
+			return nil, err
+		}
+		providerEnv := map[string]string{}
+		for key, value := range cfEnv {
+			providerEnv[key] = value
+		}
+		// the deployed worker gets keys for an IAM user, locally it uses the
+		// credentials of the CLI through the process env so they are never
+		// part of the bindings
+		if aws, ok := p.Providers["aws"].(*provider.AwsProvider); ok {
+			awsEnv, err := aws.Env()
+			if err != nil {
+				return nil, err
+			}
+			for key, value := range awsEnv {
+				providerEnv[key] = value
+			}
+		}
+		for key, value := range providerEnv {
+			result = append(result, key+"="+value)
+		}
+		bindings, err := json.Marshal(map[string]interface{}{
+			"vars":    vars,
+			"kv":      properties.KV,
+			"r2":      properties.R2,
+			"d1":      properties.D1,
+			"secrets": properties.Secrets,
+			"service": properties.Service,
+			"queue":   properties.Queue,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return append(result, "SST_WORKER_BINDINGS="+string(bindings)), nil
+	}
+
+	start := func(w *worker) {
+		build, err := runtime.Build(ctx, &runtime.BuildInput{
+			Warp:    w.warp,
+			Project: p,
+			Dev:     true,
+			Links:   complete.Links,
+		})
+		if err != nil {
+			bus.Publish(&aws.FunctionBuildEvent{
+				FunctionID: w.functionID,
+				Errors:     []string{err.Error()},
+			})
+			return
+		}
+		bus.Publish(&aws.FunctionBuildEvent{
+			FunctionID: w.functionID,
+			Errors:     build.Errors,
+		})
+		if len(build.Errors) > 0 {
+			return
+		}
+		workerEnv, err := env(w.warp)
+		if err != nil {
+			slog.Error("failed to get worker env", "err", err)
+			return
+		}
+		internal, err := freePort()
+		if err != nil {
+			slog.Error("failed to find a port for the worker", "err", err)
+			return
+		}
+		address := fmt.Sprintf("127.0.0.1:%d", internal)
+		process, err := runtime.Run(ctx, &runtime.RunInput{
+			Server:     address,
+			Project:    p,
+			WorkerID:   w.functionID,
+			FunctionID: w.functionID,
+			Runtime:    w.warp.Runtime,
+			Build:      build,
+			Env:        workerEnv,
+		})
+		if err != nil {
+			slog.Error("failed to start worker", "err", err)
+			return
+		}
+		go func() {
+			scanner := bufio.NewScanner(process.Logs())
+			for scanner.Scan() {
+				requestID, line := parseLogLine(scanner.Text())
+				bus.Publish(&aws.FunctionLogEvent{
+					FunctionID: w.functionID,
+					WorkerID:   w.functionID,
+					RequestID:  requestID,
+					Line:       line,
+				})
+			}
+		}()
+
+		ready := make(chan struct{})
+		w.Lock()
+		w.process = process
+		w.target = &url.URL{Scheme: "http", Host: address}
+		w.ready = ready
+		w.Unlock()
+		go func() {
+			for i := 0; i < 100; i++ {
+				conn, err := net.Dial("tcp", address)
+				if err == nil {
+					conn.Close()
+					close(ready)
+					return
+				}
+				time.Sleep(100 * time.Millisecond)
+			}
+			slog.Error("worker did not start", "functionID", w.functionID)
+		}()
+	}
+
+	stop := func(w *worker) {
+		w.Lock()
+		defer w.Unlock()
+		if w.process != nil {
+			w.process.Stop()
+			w.process = nil
+		}
+		w.ready = nil
+	}
+
+	// nextPort keeps the port a worker was given before, so its url does not
+	// change between deploys, and otherwise picks the next free one
+	nextPort := func(functionID string, from int) int {
+		if port, ok := ports[functionID]; ok && port >= from {
+			return port
+		}
+		port := from
+		for {
+			taken := false
+			for id, existing := range ports {
+				if existing == port && id != functionID {
+					taken = true
+					break
+				}
+			}
+			if !taken {
+				break
+			}
+			port++
+		}
+		ports[functionID] = port
+		return port
+	}
+
+	serve := func(w *worker) error {
+		var listener net.Listener
+		var err error
+		for attempt := 0; attempt < 20; attempt++ {
+			listener, err = net.Listen("tcp", fmt.Sprintf("localhost:%d", w.port))
+			if err == nil {
+				break
+			}
+			w.port = nextPort(w.functionID, w.port+1)
+		}
+		if err != nil {
+			return err
+		}
+		w.server = &http.Server{
+			Handler: http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				w.Lock()
+				ready := w.ready
+				w.Unlock()
+				if ready == nil {
+					http.Error(rw, "The worker is not running, check the build errors", http.StatusBadGateway)
+					return
+				}
+				select {
+				case <-ready:
+				case <-time.After(10 * time.Second):
+					http.Error(rw, "The worker did not start", http.StatusBadGateway)
+					return
+				case <-r.Context().Done():
+					return
+				}
+				requestID := util.RandomString(16)
+				w.Lock()
+				target := w.target
+				w.Unlock()
+				r.Header.Set(requestHeader, requestID)
+				bus.Publish(&aws.FunctionInvokedEvent{
+					FunctionID: w.functionID,
+					WorkerID:   w.functionID,
+					RequestID:  requestID,
+					Input:      []byte(r.Method + " " + r.URL.RequestURI()),
+				})
+				proxy := httputil.NewSingleHostReverseProxy(target)
+				proxy.ModifyResponse = func(response *http.Response) error {
+					bus.Publish(&aws.FunctionResponseEvent{
+						FunctionID: w.functionID,
+						WorkerID:   w.functionID,
+						RequestID:  requestID,
+						Output:     []byte(response.Status),
+					})
+					return nil
+				}
+				proxy.ErrorHandler = func(rw http.ResponseWriter, r *http.Request, err error) {
+					bus.Publish(&aws.FunctionErrorEvent{
+						FunctionID:   w.functionID,
+						WorkerID:     w.functionID,
+						RequestID:    requestID,
+						ErrorType:    "Error",
+						ErrorMessage: err.Error(),
+					})
+					http.Error(rw, err.Error(), http.StatusBadGateway)
+				}
+				proxy.ServeHTTP(rw, r)
+			}),
+		}
+		go w.server.Serve(listener)
+		bus.Publish(&aws.FunctionLogEvent{
+			FunctionID: w.functionID,
+			WorkerID:   w.functionID,
+			Line:       fmt.Sprintf("Running locally at http://localhost:%d", w.port),
+		})
+		return nil
+	}
+
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer func() {
+			for _, w := range workers {
+				stop(w)
+				w.server.Close()
+			}
+		}()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case complete = <-completeChan:
+				next := map[string]project.Warp{}
+				for functionID, warp := range complete.Warps {
+					if warp.Runtime == "worker" {
+						next[functionID] = warp
+					}
+				}
+				for functionID, w := range workers {
+					if _, ok := next[functionID]; !ok {
+						stop(w)
+						w.server.Close()
+						delete(workers, functionID)
+					}
+				}
+				for functionID, warp := range next {
+					w, ok := workers[functionID]
+					if !ok {
+						w = &worker{functionID: functionID, warp: warp, port: nextPort(functionID, FIRST_PORT)}
+						if err := serve(w); err != nil {
+							slog.Error("failed to serve worker", "functionID", functionID, "err", err)
+							continue
+						}
+						workers[functionID] = w
+					}
+					// restart on every deploy, so the links and the bindings
+					// are the ones of the current deploy
+					stop(w)
+					w.warp = warp
+					start(w)
+				}
+			case event := <-fileChan:
+				for functionID, w := range workers {
+					if !runtime.ShouldRebuild(w.warp.Runtime, functionID, event.Path) {
+						continue
+					}
+					slog.Info("restarting worker", "functionID", functionID)
+					stop(w)
+					start(w)
+				}
+			}
+		}
+	}()
+
+	return func() error {
+		slog.Info("cleaning up cloudflare workers")
+		cancel()
+		wg.Wait()
+		return nil
+	}, nil
+}
+
+// parseLogLine returns the request a log line was written for, if the worker
+// runtime marked it, and the line without the marker.
+func parseLogLine(line string) (string, string) {
+	rest, ok := strings.CutPrefix(line, logMarker)
+	if !ok {
+		return "", line
+	}
+	requestID, text, ok := strings.Cut(rest, logMarker)
+	if !ok {
+		return "", line
+	}
+	return requestID, text
+}
+
+func freePort() (int, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/sst/ion/pkg/project/provider"
 	"github.com/sst/ion/pkg/server/bus"
 	"github.com/sst/ion/pkg/server/dev/aws"
+	"github.com/sst/ion/pkg/server/dev/cloudflare"
 	"github.com/sst/ion/pkg/server/dev/watcher"
 	"github.com/sst/ion/pkg/server/socket"
 )
@@ -180,6 +181,12 @@ func (s *Server) Start(parentContext context.Context) error {
 				return err
 			}
 			defer cleanup()
+		case *provider.CloudflareProvider:
+			cleanup, err := cloudflare.Start(ctx, casted, s.project)
+			if err != nil {
+				return err
+			}
+			defer cleanup()
 		}
 	}
 